@@ -17,6 +17,7 @@ limitations under the License.
 package app
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/openGemini/openGemini-forwarder/conf"
@@ -39,8 +40,17 @@ type Command struct {
 	NewServerFunc func(conf.Config, *cobra.Command, *logger.Logger) (Server, error)
 }
 
+// Close stops the server, which drains the dag, and removes the PID file.
 func (cmd *Command) Close() error {
-	return nil
+	defer close(cmd.Closed)
+	close(cmd.closing)
+
+	var err error
+	if cmd.Server != nil {
+		err = cmd.Server.Close()
+	}
+	RemovePIDFile(cmd.Pidfile)
+	return err
 }
 
 type Server interface {
@@ -56,13 +66,13 @@ func NewCommand() *Command {
 	}
 }
 
-func (cmd *Command) InitConfig(c *conf.Config, path string) error {
-	if err := conf.Parse(c, path); err != nil {
-		return fmt.Errorf("parse config: %s", err)
+func (cmd *Command) InitConfig(c *conf.Config, path string, dir string) error {
+	if err := conf.Parse(c, path, dir); err != nil {
+		return fmt.Errorf("parse config: %s", c.Redact(err.Error()))
 	}
 
 	if err := c.Validate(); err != nil {
-		return err
+		return errors.New(c.Redact(err.Error()))
 	}
 
 	cmd.Config = c
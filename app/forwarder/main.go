@@ -17,9 +17,12 @@ limitations under the License.
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/procutil"
 	"github.com/influxdata/influxdb/cmd"
@@ -41,10 +44,14 @@ var (
 
 var (
 	confPath = flag.String("config", "", "-config=forwarder config file path")
+	confDir  = flag.String("config-directory", "", "-config-directory=directory of *.conf config fragments")
 	pidPath  = flag.String("pidfile", "", "-pid=forwarder pid file path")
 )
 
-var versionUsage = `forwarder -config=config_file_path -pidfile=pid_file_path`
+var versionUsage = `forwarder -config=config_file_path -config-directory=config_dir -pidfile=pid_file_path
+forwarder replay -config=config_file_path -config-directory=config_dir
+forwarder config check -config=config_file_path -config-directory=config_dir
+forwarder config sample`
 
 func usage() {
 	fmt.Println(versionUsage)
@@ -62,17 +69,18 @@ func main() {
 }
 
 func doRun(args ...string) error {
-	name, _ := cmd.ParseCommandName(args)
+	name, args := cmd.ParseCommandName(args)
 
 	switch name {
 	case "", "run":
 		mainCmd := app.NewCommand()
-		err := mainCmd.InitConfig(conf.NewConfig(), *confPath)
+		err := mainCmd.InitConfig(conf.NewConfig(), *confPath, *confDir)
 		if err != nil {
 			return err
 		}
 
 		logger.InitLogger(mainCmd.Config.GetLogConfig())
+		util.SetLogger(logger.GetLogger())
 		mainCmd.Logger = logger.NewLogger("forwarder")
 		mainCmd.Command = &cobra.Command{
 			Use:                app.ForwarderUsage,
@@ -92,9 +100,11 @@ func doRun(args ...string) error {
 				if err != nil {
 					return fmt.Errorf("create server: %s", err)
 				}
+				s.ConfigPath, s.ConfigDir = *confPath, *confDir
 				if err := s.Open(); err != nil {
-					return fmt.Errorf("open server: %s", err)
+					return fmt.Errorf("open server: %s", mainCmd.Config.Redact(err.Error()))
 				}
+				go reloadOnSignal(s, mainCmd.Logger)
 
 				mainCmd.Server = s
 				mainCmd.Logger.Info("Forwarder:RunE")
@@ -110,8 +120,79 @@ func doRun(args ...string) error {
 		mainCmd.Logger.Info("} service received shutdown signal", zap.Any("signal", signal))
 		util.MustClose(mainCmd)
 		mainCmd.Logger.Info("forwarder shutdown successfully!")
+	case "replay":
+		return doReplay(args)
+	case "config":
+		return doConfig(args)
 	default:
 		return fmt.Errorf(`unknown command, usage:\n "%s"`+"\n\n", versionUsage)
 	}
 	return nil
 }
+
+// reloadOnSignal reloads the config of s on SIGHUP.
+func reloadOnSignal(s *run.Server, log *logger.Logger) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		if err := s.Reload(); err != nil {
+			log.Error("reload config failed", zap.Error(err))
+		}
+	}
+}
+
+// doReplay sends the dead letters back into their pipelines.
+func doReplay(args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	path := fs.String("config", *confPath, "-config=forwarder config file path")
+	dir := fs.String("config-directory", *confDir, "-config-directory=directory of *.conf config fragments")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	mainCmd := app.NewCommand()
+	if err := mainCmd.InitConfig(conf.NewConfig(), *path, *dir); err != nil {
+		return err
+	}
+	logger.InitLogger(mainCmd.Config.GetLogConfig())
+	util.SetLogger(logger.GetLogger())
+	return run.Replay(mainCmd.Config)
+}
+
+// doConfig checks a config file, or prints the sample config of the plugins.
+func doConfig(args []string) error {
+	name, args := cmd.ParseCommandName(args)
+	switch name {
+	case "check":
+		return doConfigCheck(args)
+	case "sample":
+		return conf.Sample(os.Stdout)
+	default:
+		return fmt.Errorf(`unknown config command, usage:\n "%s"`+"\n\n", versionUsage)
+	}
+}
+
+// doConfigCheck parses and validates a config file and builds its dag
+// without starting it.
+func doConfigCheck(args []string) error {
+	fs := flag.NewFlagSet("config check", flag.ContinueOnError)
+	path := fs.String("config", *confPath, "-config=forwarder config file path")
+	dir := fs.String("config-directory", *confDir, "-config-directory=directory of *.conf config fragments")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *path == "" && *dir == "" {
+		return errors.New("config check: -config or -config-directory is required")
+	}
+
+	mainCmd := app.NewCommand()
+	if err := mainCmd.InitConfig(conf.NewConfig(), *path, *dir); err != nil {
+		return err
+	}
+	logger.SetLogger(zap.NewNop())
+	if err := run.Check(mainCmd.Config); err != nil {
+		return fmt.Errorf("build pipelines: %s", mainCmd.Config.Redact(err.Error()))
+	}
+	fmt.Fprintln(os.Stdout, "config ok")
+	return nil
+}
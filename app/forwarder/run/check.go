@@ -0,0 +1,33 @@
+/*
+Copyright 2022 Huawei Cloud Computing Technologies Co., Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package run
+
+import (
+	"github.com/openGemini/openGemini-forwarder/conf"
+	"github.com/openGemini/openGemini-forwarder/dag"
+)
+
+// Check builds the dag of c and initializes its nodes without starting
+// them, so that the problems found only by the plugins, such as a TLS file
+// that cannot be read, are reported too.
+func Check(c *conf.Config) error {
+	d, err := dag.NewDag(c)
+	if err != nil {
+		return err
+	}
+	return d.Init()
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2022 Huawei Cloud Computing Technologies Co., Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package run
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/openGemini/openGemini-forwarder/dag"
+)
+
+// healthResponse is the body of /health and /ready.
+type healthResponse struct {
+	Status     string       `json:"status"`
+	Components []dag.Status `json:"components"`
+}
+
+// serveHealth answers whether every pipeline runs.
+func (s *Server) serveHealth(w http.ResponseWriter, _ *http.Request) {
+	d := s.currentDag()
+	var statuses []dag.Status
+	if d != nil {
+		statuses = d.Health()
+	}
+	writeStatus(w, statuses, d != nil)
+}
+
+// serveReady answers whether every pipeline runs and all of its nodes and
+// edges are able to move records.
+func (s *Server) serveReady(w http.ResponseWriter, _ *http.Request) {
+	d := s.currentDag()
+	var statuses []dag.Status
+	if d != nil {
+		statuses = d.Ready()
+	}
+	writeStatus(w, statuses, d != nil)
+}
+
+func (s *Server) currentDag() *dag.Dag {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.dag
+}
+
+// writeStatus answers 200 if every component is healthy and 503 otherwise,
+// with the status of each component.
+func writeStatus(w http.ResponseWriter, statuses []dag.Status, started bool) {
+	resp := healthResponse{Status: "pass", Components: statuses}
+	code := http.StatusOK
+	if !started {
+		resp.Status = "fail"
+		code = http.StatusServiceUnavailable
+	}
+	for _, status := range statuses {
+		if !status.Healthy {
+			resp.Status = "fail"
+			code = http.StatusServiceUnavailable
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(resp)
+}
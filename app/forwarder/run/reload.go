@@ -0,0 +1,85 @@
+/*
+Copyright 2022 Huawei Cloud Computing Technologies Co., Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package run
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+
+	"github.com/openGemini/openGemini-forwarder/conf"
+	"go.uber.org/zap"
+)
+
+// Reload parses the config file again and applies its pipelines to the
+// running dag. The other sections take effect after a restart.
+func (s *Server) Reload() error {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	d := s.currentDag()
+	if d == nil {
+		return errors.New("server is not open")
+	}
+
+	c := conf.NewConfig()
+	if err := conf.Parse(c, s.ConfigPath, s.ConfigDir); err != nil {
+		return fmt.Errorf("parse config: %s", c.Redact(err.Error()))
+	}
+	if err := c.Validate(); err != nil {
+		return errors.New(c.Redact(err.Error()))
+	}
+
+	if err := s.checkPatterns(patterns(c.Inputs)); err != nil {
+		return err
+	}
+
+	if !reflect.DeepEqual(c.Http, s.Conf.Http) || !reflect.DeepEqual(c.Logging, s.Conf.Logging) ||
+		!reflect.DeepEqual(c.DeadLetter, s.Conf.DeadLetter) || !reflect.DeepEqual(c.DiskBuffer, s.Conf.DiskBuffer) {
+		s.Logger.Warn("only the plugins and pipelines are reloaded, the other changes take effect after a restart")
+	}
+	// the pipelines keep running with the sections that are not reloaded
+	c.Http = s.Conf.Http
+	c.Logging = s.Conf.Logging
+	c.DeadLetter = s.Conf.DeadLetter
+	c.DiskBuffer = s.Conf.DiskBuffer
+	if err := d.Reload(c); err != nil {
+		return errors.New(c.Redact(err.Error()))
+	}
+	s.Conf = c
+	if err := s.handleInputs(d); err != nil {
+		return err
+	}
+	s.Logger.Info("config reloaded", zap.String("path", s.ConfigPath), zap.String("directory", s.ConfigDir))
+	return nil
+}
+
+// serveReload reloads the config on POST.
+func (s *Server) serveReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := s.Reload(); err != nil {
+		s.Logger.Error("reload config failed", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2022 Huawei Cloud Computing Technologies Co., Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package run
+
+import (
+	"errors"
+
+	"github.com/openGemini/openGemini-forwarder/conf"
+	"github.com/openGemini/openGemini-forwarder/dag"
+	"github.com/openGemini/openGemini-forwarder/dag/node"
+	"github.com/openGemini/openGemini-forwarder/lib/deadletter"
+)
+
+// Replay sends the dead letters back into their pipelines. The pipelines
+// of c run with their parsers and outputs, their inputs are replaced by
+// the replayed items. Items that fail again are kept in the sink.
+func Replay(c *conf.Config) error {
+	if !c.DeadLetter.Enabled {
+		return errors.New("dead-letter is not enabled")
+	}
+
+	pipelines := c.Pipelines
+	if len(pipelines) == 0 {
+		pipelines = []*conf.Pipeline{{
+			Name:       dag.DefaultPipeline,
+			Parsers:    c.Parsers,
+			Processors: c.Processors,
+			Outputs:    c.Outputs,
+		}}
+	}
+	rc := *c
+	rc.Inputs, rc.Pipelines = nil, nil
+	// the replayed items go straight to the outputs, the disk buffers are
+	// left to the pipelines of the forwarder
+	rc.DiskBuffer.Enabled = false
+	inputs := make(map[string]*deadletter.Input, len(pipelines))
+	for _, p := range pipelines {
+		in := &deadletter.Input{}
+		inputs[p.Name] = in
+		rc.Inputs = append(rc.Inputs, in)
+		rc.Pipelines = append(rc.Pipelines, &conf.Pipeline{
+			Name:       p.Name,
+			Inputs:     []node.Node{in},
+			Parsers:    p.Parsers,
+			Processors: p.Processors,
+			Outputs:    p.Outputs,
+		})
+	}
+
+	d, err := dag.NewDag(&rc)
+	if err != nil {
+		return err
+	}
+	if err = d.Init(); err != nil {
+		return err
+	}
+	sink, err := deadletter.NewSink(c.DeadLetter)
+	if err != nil {
+		return err
+	}
+	defer sink.Close()
+
+	if err = d.Start(); err != nil {
+		return err
+	}
+	err = deadletter.Replay(sink, inputs)
+	if serr := d.Stop(); err == nil {
+		err = serr
+	}
+	return err
+}
@@ -22,12 +22,16 @@ import (
 	"net/http"
 	"os"
 	"runtime"
+	"sync"
 	"time"
 
 	"github.com/influxdata/influxdb/tcp"
 	"github.com/openGemini/openGemini-forwarder/conf"
 	"github.com/openGemini/openGemini-forwarder/dag"
+	"github.com/openGemini/openGemini-forwarder/dag/node"
+	"github.com/openGemini/openGemini-forwarder/lib/deadletter"
 	"github.com/openGemini/openGemini-forwarder/lib/logger"
+	"github.com/openGemini/openGemini-forwarder/lib/metrics"
 	_ "github.com/openGemini/openGemini-forwarder/plugins"
 	"github.com/openGemini/openGemini/lib/cpu"
 	"github.com/spf13/cobra"
@@ -39,9 +43,25 @@ type Server struct {
 
 	BindAddress string
 	Listener    net.Listener
+	// Handler serves the http requests of the listener
+	Handler    *http.ServeMux
+	httpServer *http.Server
 
 	Logger *logger.Logger
 	Conf   *conf.Config
+	// ConfigPath and ConfigDir are the file and the directory of fragments
+	// Reload parses
+	ConfigPath string
+	ConfigDir  string
+
+	// routes maps the paths served by the listener to whether an input
+	// serves them
+	routes map[string]bool
+
+	mu         sync.RWMutex
+	reloadMu   sync.Mutex
+	dag        *dag.Dag
+	deadLetter deadletter.Sink
 }
 
 // NewServer returns a new instance of Server built from a config.
@@ -53,7 +73,13 @@ func NewServer(conf *conf.Config, cmd *cobra.Command, logger *logger.Logger) (*S
 		BindAddress: bind,
 		Logger:      logger,
 		Conf:        conf,
+		Handler:     http.NewServeMux(),
 	}
+	s.Handler.Handle("/metrics", metrics.Handler())
+	s.Handler.HandleFunc("/health", s.serveHealth)
+	s.Handler.HandleFunc("/ready", s.serveReady)
+	s.Handler.HandleFunc("/reload", s.serveReload)
+	s.routes = map[string]bool{"/metrics": false, "/health": false, "/ready": false, "/reload": false}
 
 	runtime.SetBlockProfileRate(int(1 * time.Second))
 	runtime.SetMutexProfileFraction(1)
@@ -94,6 +120,12 @@ func (s *Server) Open() error {
 
 	// Multiplex listener.
 	mux := tcp.NewMux(tcp.MuxLogger(os.Stdout))
+	s.httpServer = &http.Server{Handler: s.Handler}
+	go func() {
+		if err := s.httpServer.Serve(mux.DefaultListener()); err != nil && err != http.ErrServerClosed {
+			s.Logger.Error("serve http failed", zap.Error(err))
+		}
+	}()
 	go func() {
 		if err := mux.Serve(ln); err != nil {
 			s.Logger.Error("listen failed",
@@ -102,27 +134,118 @@ func (s *Server) Open() error {
 		}
 	}()
 
-	dag, err := dag.NewDag(s.Conf)
+	d, err := dag.NewDag(s.Conf)
 	if err != nil {
 		return err
 	}
-	err = dag.Init()
+	if err = s.handleInputs(d); err != nil {
+		return err
+	}
+	if s.Conf.DeadLetter.Enabled {
+		if s.deadLetter, err = deadletter.NewSink(s.Conf.DeadLetter); err != nil {
+			return fmt.Errorf("open dead-letter sink: %s", err)
+		}
+		d.SetDeadLetter(s.deadLetter)
+	}
+	err = d.Init()
 	if err != nil {
 		return err
 	}
-	go func() {
-		dag.Start()
-	}()
+	if err = metrics.Registry.Register(d); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.dag = d
+	s.mu.Unlock()
+	return d.Start()
+}
+
+// handleInputs serves the paths of the inputs of d on the listener. The
+// input serving a path is looked up in the running dag on each request, so
+// that the paths follow the reloads, a path no input serves any more is
+// answered 404.
+func (s *Server) handleInputs(d *dag.Dag) error {
+	patterns := d.Patterns()
+	if err := s.checkPatterns(patterns); err != nil {
+		return err
+	}
+	for _, pattern := range patterns {
+		if s.routes[pattern] {
+			continue
+		}
+		pattern := pattern
+		s.Handler.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+			d := s.currentDag()
+			if d == nil {
+				http.NotFound(w, r)
+				return
+			}
+			h := d.Handler(pattern)
+			if h == nil {
+				http.NotFound(w, r)
+				return
+			}
+			h.ServeHTTP(w, r)
+		})
+		s.routes[pattern] = true
+	}
+	return nil
+}
 
+// checkPatterns returns an error if one of the paths of the inputs is
+// served by several of them or reserved by the server.
+func (s *Server) checkPatterns(patterns []string) error {
+	seen := make(map[string]bool)
+	for _, pattern := range patterns {
+		if seen[pattern] {
+			return fmt.Errorf("path %s is served by several inputs", pattern)
+		}
+		seen[pattern] = true
+		if input, ok := s.routes[pattern]; ok && !input {
+			return fmt.Errorf("path %s is reserved", pattern)
+		}
+	}
 	return nil
 }
 
-// Close shuts down the meta service.
+// patterns returns the paths inputs serve on the listener.
+func patterns(inputs []node.Node) []string {
+	var patterns []string
+	for _, n := range inputs {
+		if h, ok := n.(node.Handler); ok && h.Pattern() != "" {
+			patterns = append(patterns, h.Pattern())
+		}
+	}
+	return patterns
+}
+
+// Close drains and stops the dag, then closes the dead-letter sink and the
+// listener.
 func (s *Server) Close() error {
 	var err error
-	// Close the listener first to stop any new connections
+	if s.dag != nil {
+		if err = s.dag.Stop(); err != nil {
+			s.Logger.Error("stop dag failed", zap.Error(err))
+		}
+		metrics.Registry.Unregister(s.dag)
+	}
+
+	if s.deadLetter != nil {
+		if derr := s.deadLetter.Close(); err == nil {
+			err = derr
+		}
+	}
+
+	if s.httpServer != nil {
+		if herr := s.httpServer.Close(); err == nil {
+			err = herr
+		}
+	}
+
 	if s.Listener != nil {
-		err = s.Listener.Close()
+		if lerr := s.Listener.Close(); err == nil {
+			err = lerr
+		}
 	}
 
 	return err
@@ -0,0 +1,73 @@
+/*
+Copyright 2022 Huawei Cloud Computing Technologies Co., Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package conf
+
+import (
+	"errors"
+
+	"github.com/influxdata/influxdb/toml"
+)
+
+const (
+	// DefaultDiskBufferDir is the default directory of the disk buffers
+	DefaultDiskBufferDir = "/opt/openGemini/buffer/"
+
+	// DefaultDiskBufferMaxSize is the default size cap of the buffer of an
+	// output
+	DefaultDiskBufferMaxSize = 1024 * 1024 * 1024 // 1GB
+
+	// DefaultDiskBufferSegmentSize is the size a segment is rotated at
+	DefaultDiskBufferSegmentSize = 64 * 1024 * 1024 // 64MB
+)
+
+// DiskBuffer configures the disk-backed edges in front of the outputs,
+// records are acked to the inputs once they are written to disk.
+type DiskBuffer struct {
+	Enabled     bool      `toml:"enabled"`
+	Dir         string    `toml:"dir"`
+	MaxSize     toml.Size `toml:"max-size"`
+	SegmentSize toml.Size `toml:"segment-size"`
+}
+
+func NewDiskBuffer() *DiskBuffer {
+	return &DiskBuffer{
+		Dir:         DefaultDiskBufferDir,
+		MaxSize:     toml.Size(DefaultDiskBufferMaxSize),
+		SegmentSize: toml.Size(DefaultDiskBufferSegmentSize),
+	}
+}
+
+// Validate validates that the configuration is acceptable.
+func (c DiskBuffer) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+
+	if c.Dir == "" {
+		return errors.New("disk-buffer dir must not be empty")
+	}
+
+	if c.SegmentSize <= 0 {
+		return errors.New("disk-buffer segment-size must be positive")
+	}
+
+	if c.MaxSize < c.SegmentSize {
+		return errors.New("disk-buffer max-size must not be less than segment-size")
+	}
+
+	return nil
+}
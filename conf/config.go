@@ -19,7 +19,12 @@ package conf
 import (
 	"fmt"
 	"io/ioutil"
+	"math"
 	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
 
 	"github.com/influxdata/influxdb/pkg/tlsconfig"
 	"github.com/influxdata/toml"
@@ -28,17 +33,44 @@ import (
 	"github.com/openGemini/openGemini-forwarder/plugins/inputs"
 	"github.com/openGemini/openGemini-forwarder/plugins/outputs"
 	"github.com/openGemini/openGemini-forwarder/plugins/parsers"
+	"github.com/openGemini/openGemini-forwarder/plugins/processors"
 )
 
 type Config struct {
-	toml    *toml.Config
-	Logging *Logger           `toml:"logging"`
-	TLS     *tlsconfig.Config `toml:"tls"`
-	Http    *Http             `toml:"http"`
+	toml       *toml.Config
+	Logging    *Logger           `toml:"logging"`
+	TLS        *tlsconfig.Config `toml:"tls"`
+	Http       *Http             `toml:"http"`
+	DeadLetter *DeadLetter       `toml:"dead-letter"`
+	DiskBuffer *DiskBuffer       `toml:"disk-buffer"`
 
-	Inputs  []node.Node
-	Outputs []node.Node
-	Parsers []node.Node
+	Inputs     []node.Node
+	Outputs    []node.Node
+	Parsers    []node.Node
+	Processors []node.Node
+
+	// Pipelines is empty unless the config declares [[pipelines.<name>]]
+	// tables, all plugins then form a single flow.
+	Pipelines []*Pipeline
+
+	pipelines []*pipelineConfig
+	aliases   map[PluginType]map[string][]node.Node
+	names     map[node.Node]string
+	digests   map[node.Node]string
+	sources   map[node.Node]source
+	secrets   []string
+
+	// files are the config files parsed, settings maps the keys of the
+	// top-level sections to the file that set them.
+	files    []string
+	settings map[string]string
+}
+
+// source is the table a plugin instance was decoded from.
+type source struct {
+	file  int
+	table string
+	line  int
 }
 
 func NewConfig() *Config {
@@ -47,12 +79,33 @@ func NewConfig() *Config {
 		toml: &toml.Config{
 			NormFieldName: toml.DefaultConfig.NormFieldName,
 			FieldToKey:    toml.DefaultConfig.FieldToKey},
-		Http:    NewHttpConfig(),
-		Logging: NewLogger("forwarder"),
-		TLS:     &tls,
+		Http:       NewHttpConfig(),
+		Logging:    NewLogger("forwarder"),
+		TLS:        &tls,
+		DeadLetter: NewDeadLetter(),
+		DiskBuffer: NewDiskBuffer(),
+		aliases:    make(map[PluginType]map[string][]node.Node),
+		names:      make(map[node.Node]string),
+		digests:    make(map[node.Node]string),
+		sources:    make(map[node.Node]source),
+		settings:   make(map[string]string),
 	}
 }
 
+// Alias returns the name a plugin instance is referenced by in pipelines.
+func (c *Config) Alias(n node.Node) string {
+	if name, ok := c.names[n]; ok {
+		return name
+	}
+	return n.Name()
+}
+
+// Digest returns a canonical form of the table a plugin instance was
+// decoded from, two instances with the same digest have the same config.
+func (c *Config) Digest(n node.Node) string {
+	return c.digests[n]
+}
+
 func (c *Config) GetLogConfig() Logger {
 	return *c.Logging
 }
@@ -61,104 +114,394 @@ type Validator interface {
 	Validate() error
 }
 
+// Validate checks the settings and the plugins implementing Validator, all
+// the problems found are returned as Errors.
 func (c *Config) Validate() error {
 	items := []Validator{
 		c.Logging,
+		c.DeadLetter,
+		c.DiskBuffer,
 	}
 
+	var errs Errors
 	for _, item := range items {
 		if err := item.Validate(); err != nil {
-			return err
+			errs = append(errs, err)
+		}
+	}
+
+	for _, p := range c.plugins() {
+		v, ok := p.(Validator)
+		if !ok {
+			continue
+		}
+		if err := v.Validate(); err != nil {
+			src := c.sources[p]
+			errs = append(errs, c.fileError(src.file,
+				&toml.LineError{Line: src.line, Err: fmt.Errorf("%s: %v", src.table, err)}))
+		}
+	}
+	return errs.orNil()
+}
+
+func (c *Config) plugins() []node.Node {
+	plugins := make([]node.Node, 0, len(c.Inputs)+len(c.Parsers)+len(c.Processors)+len(c.Outputs))
+	plugins = append(plugins, c.Inputs...)
+	plugins = append(plugins, c.Parsers...)
+	plugins = append(plugins, c.Processors...)
+	return append(plugins, c.Outputs...)
+}
+
+// Errors lists the problems found in a config, sorted by line.
+type Errors []error
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// orNil sorts the errors by file and line, the ones without a line last in
+// their file, and returns nil if there are none.
+func (e Errors) orNil() error {
+	if len(e) == 0 {
+		return nil
+	}
+	pos := func(err error) (int, int) {
+		file := 0
+		if fe, ok := err.(*fileError); ok {
+			file, err = fe.file, fe.err
 		}
+		if le, ok := err.(*toml.LineError); ok {
+			return file, le.Line
+		}
+		return file, math.MaxInt32
 	}
+	sort.SliceStable(e, func(i, j int) bool {
+		fi, li := pos(e[i])
+		fj, lj := pos(e[j])
+		return fi < fj || fi == fj && li < lj
+	})
+	return e
+}
 
-	return nil
+// fileError is an error of the file at index file of Config.files.
+type fileError struct {
+	file int
+	name string
+	err  error
 }
 
-func Parse(conf *Config, path string) error {
-	if path == "" {
+func (e *fileError) Error() string {
+	return e.name + ": " + e.err.Error()
+}
+
+// fileError names the file of err when the config has several files.
+func (c *Config) fileError(file int, err error) error {
+	if len(c.files) < 2 {
+		return err
+	}
+	return &fileError{file: file, name: c.files[file], err: err}
+}
+
+// Parse parses the config file at path, then the *.conf files of dir in
+// lexical order, either may be empty. The plugin and pipeline tables of
+// all files are added to c, a key of the other sections may be set by one
+// file only.
+func Parse(conf *Config, path string, dir string) error {
+	if path != "" {
+		conf.files = append(conf.files, path)
+	}
+	if dir != "" {
+		matches, err := filepath.Glob(filepath.Join(dir, "*.conf"))
+		if err != nil {
+			return err
+		}
+		sort.Strings(matches)
+		conf.files = append(conf.files, matches...)
+	}
+	if len(conf.files) == 0 {
 		return nil
 	}
 
-	return fromTomlFile(conf, path)
+	var errs Errors
+	for i := range conf.files {
+		err := fromTomlFile(conf, i)
+		if fe, ok := err.(Errors); ok {
+			for _, e := range fe {
+				errs = append(errs, conf.fileError(i, e))
+			}
+		} else if err != nil {
+			errs = append(errs, conf.fileError(i, err))
+		}
+	}
+	if len(errs) > 0 {
+		return errs.orNil()
+	}
+	return conf.resolvePipelines()
 }
 
-func fromTomlFile(c *Config, p string) error {
-	content, err := ioutil.ReadFile(path.Clean(p))
+func fromTomlFile(c *Config, file int) error {
+	content, err := ioutil.ReadFile(path.Clean(c.files[file]))
 	if err != nil {
 		return err
 	}
 
+	content, secrets, err := expand(content)
+	if err != nil {
+		return err
+	}
+	c.addSecrets(secrets)
+
 	table, err := toml.Parse(content)
 	if err != nil {
 		return err
 	}
 
+	var errs Errors
 	for name, value := range table.Fields {
 		t, ok := value.(*ast.Table)
 		if !ok {
-			return fmt.Errorf("%v config format error", name)
+			errs = append(errs, fmt.Errorf("%v config format error", name))
+			continue
 		}
 		switch name {
 		case "logging":
-			if err = c.toml.UnmarshalTable(t, c.Logging); err != nil {
-				return err
-			}
+			errs = append(errs, c.unmarshalSection(t, c.Logging, name, file)...)
 		case "tls":
-			if err = c.toml.UnmarshalTable(t, c.TLS); err != nil {
-				return err
-			}
+			errs = append(errs, c.unmarshalSection(t, c.TLS, name, file)...)
 		case "http":
-			if err = c.toml.UnmarshalTable(t, c.Http); err != nil {
-				return err
-			}
+			errs = append(errs, c.unmarshalSection(t, c.Http, name, file)...)
+		case "dead-letter":
+			errs = append(errs, c.unmarshalSection(t, c.DeadLetter, name, file)...)
+		case "disk-buffer":
+			errs = append(errs, c.unmarshalSection(t, c.DiskBuffer, name, file)...)
 		case "inputs":
 			inputs := inputs.GetInputs()
-			err = ParsePlugins(t, INPUT, c, inputs)
-			if err != nil {
-				return fmt.Errorf("inputs plugins fail %v", err)
-			}
+			errs = append(errs, c.parsePlugins(t, INPUT, file, inputs)...)
 		case "parsers":
 			parsers := parsers.GetParsers()
-			err = ParsePlugins(t, PARSER, c, parsers)
-			if err != nil {
-				return fmt.Errorf("parsers plugins fail %v", err)
-			}
+			errs = append(errs, c.parsePlugins(t, PARSER, file, parsers)...)
+		case "processors":
+			processors := processors.GetProcessors()
+			errs = append(errs, c.parsePlugins(t, PROCESSOR, file, processors)...)
 		case "outputs":
 			outputs := outputs.GetOutputs()
-			err = ParsePlugins(t, OUTPUT, c, outputs)
-			if err != nil {
-				return fmt.Errorf("output plugins fail %v", err)
+			errs = append(errs, c.parsePlugins(t, OUTPUT, file, outputs)...)
+		case "pipelines":
+			if err := c.parsePipelines(t, file); err != nil {
+				errs = append(errs, err)
+			}
+		default:
+			errs = append(errs, &toml.LineError{Line: t.Line, Err: fmt.Errorf("unknown section [%s]", name)})
+		}
+	}
+	return errs.orNil()
+}
+
+// unmarshalSection decodes the top-level section name of the file at index
+// file into v, the keys set by a previous file are reported as conflicts.
+func (c *Config) unmarshalSection(t *ast.Table, v interface{}, name string, file int) []error {
+	var errs []error
+	for key := range t.Fields {
+		setting := name + "." + key
+		if prev, ok := c.settings[setting]; ok {
+			errs = append(errs, &toml.LineError{Line: keyLine(t, key),
+				Err: fmt.Errorf("[%s]: %s is already set in %s", name, key, prev)})
+			continue
+		}
+		c.settings[setting] = c.files[file]
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return c.unmarshal(t, v, "["+name+"]")
+}
+
+// unmarshal decodes t into v, the keys v has no field for are reported
+// with their line instead of stopping the decoding. where names the table
+// in the errors.
+func (c *Config) unmarshal(t *ast.Table, v interface{}, where string) []error {
+	var unknown []string
+	cfg := *c.toml
+	cfg.MissingField = func(_ reflect.Type, key string) error {
+		unknown = append(unknown, key)
+		return nil
+	}
+
+	var errs []error
+	if err := cfg.UnmarshalTable(t, v); err != nil {
+		errs = append(errs, err)
+	}
+	for _, key := range unknown {
+		errs = append(errs, &toml.LineError{Line: keyLine(t, key),
+			Err: fmt.Errorf("%s: unknown key %q", where, key)})
+	}
+	return errs
+}
+
+// keyLine returns the line of key in t or in its sub-tables, or the line of
+// t if it is not found.
+func keyLine(t *ast.Table, key string) int {
+	if v, ok := t.Fields[key]; ok {
+		switch v := v.(type) {
+		case *ast.KeyValue:
+			return v.Line
+		case *ast.Table:
+			return v.Line
+		case []*ast.Table:
+			return v[0].Line
+		}
+	}
+	for _, v := range t.Fields {
+		var subs []*ast.Table
+		switch v := v.(type) {
+		case *ast.Table:
+			subs = []*ast.Table{v}
+		case []*ast.Table:
+			subs = v
+		}
+		for _, sub := range subs {
+			if line := keyLine(sub, key); line != sub.Line {
+				return line
 			}
 		}
 	}
-	return nil
+	return t.Line
+}
+
+// ParsePlugins decodes the plugin tables of t, it goes on after a table
+// fails so that all the errors are returned.
+func ParsePlugins(t *ast.Table, ty PluginType, c *Config, creator map[string]node.Creator) []error {
+	return c.parsePlugins(t, ty, 0, creator)
 }
 
-func ParsePlugins(t *ast.Table, ty PluginType, c *Config, creator map[string]node.Creator) error {
+func (c *Config) parsePlugins(t *ast.Table, ty PluginType, file int, creator map[string]node.Creator) []error {
 	var ps *[]node.Node
 	if ty == INPUT {
 		ps = &c.Inputs
 	} else if ty == OUTPUT {
 		ps = &c.Outputs
+	} else if ty == PROCESSOR {
+		ps = &c.Processors
 	} else {
 		ps = &c.Parsers
 	}
 
-	for name, v := range t.Fields {
-		plugin, ok := creator[name]
+	tables, err := pluginTables(t)
+	if err != nil {
+		return []error{err}
+	}
+	var errs []error
+	for _, pt := range tables {
+		plugin, ok := creator[pt.name]
 		if !ok {
-			return fmt.Errorf("undefined plugin %v", name)
+			errs = append(errs, &toml.LineError{Line: pt.table.Line,
+				Err: fmt.Errorf("undefined plugin [[%ss.%s]]", ty, pt.name)})
+			continue
+		}
+		alias, err := takeAlias(pt.table)
+		if err != nil {
+			errs = append(errs, err)
+			continue
 		}
 		p := plugin()
-		vv, ok := v.([]*ast.Table)
-		if !ok || len(vv) != 1 {
-			return fmt.Errorf("%v config format error", name)
+		src := source{file: file, table: fmt.Sprintf("[[%ss.%s]]", ty, pt.name), line: pt.table.Line}
+		if perrs := c.unmarshal(pt.table, p, src.table); len(perrs) > 0 {
+			errs = append(errs, perrs...)
+			continue
 		}
-		if err := c.toml.UnmarshalTable(vv[0], p); err != nil {
-			return err
+		if alias == "" {
+			alias = pt.name
+		} else if len(c.aliases[ty][alias]) > 0 {
+			errs = append(errs, fmt.Errorf("line %d: duplicate %s alias %q", pt.table.Line, ty, alias))
+			continue
+		}
+		if c.aliases[ty] == nil {
+			c.aliases[ty] = make(map[string][]node.Node)
 		}
+		c.aliases[ty][alias] = append(c.aliases[ty][alias], p)
+		c.names[p] = alias
+		c.digests[p] = tableDigest(pt.table)
+		c.sources[p] = src
 		*ps = append(*ps, p)
 	}
-	return nil
+	return errs
+}
+
+// takeAlias removes the alias key shared by all plugin tables, so that the
+// rest of the table can be decoded into the plugin.
+func takeAlias(t *ast.Table) (string, error) {
+	v, ok := t.Fields["alias"]
+	if !ok {
+		return "", nil
+	}
+	kv, ok := v.(*ast.KeyValue)
+	if !ok {
+		return "", fmt.Errorf("line %d: alias must be a string", t.Line)
+	}
+	s, ok := kv.Value.(*ast.String)
+	if !ok || s.Value == "" {
+		return "", fmt.Errorf("line %d: alias must be a non-empty string", kv.Line)
+	}
+	delete(t.Fields, "alias")
+	return s.Value, nil
+}
+
+// tableDigest writes the fields of t sorted by key, so that the digest does
+// not depend on their order or on comments.
+func tableDigest(t *ast.Table) string {
+	keys := make([]string, 0, len(t.Fields))
+	for k := range t.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for _, k := range keys {
+		b.WriteString(k)
+		b.WriteByte('=')
+		switch v := t.Fields[k].(type) {
+		case *ast.KeyValue:
+			b.WriteString(v.Value.Source())
+		case *ast.Table:
+			b.WriteString(tableDigest(v))
+		case []*ast.Table:
+			b.WriteByte('[')
+			for _, sub := range v {
+				b.WriteString(tableDigest(sub))
+			}
+			b.WriteByte(']')
+		}
+		b.WriteByte(';')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+type pluginTable struct {
+	name  string
+	table *ast.Table
+}
+
+// pluginTables flattens the [[<kind>.<name>]] tables of t in the order
+// they appear in the config file, a plugin may be declared more than once.
+func pluginTables(t *ast.Table) ([]pluginTable, error) {
+	var tables []pluginTable
+	for name, v := range t.Fields {
+		vv, ok := v.([]*ast.Table)
+		if !ok || len(vv) == 0 {
+			return nil, fmt.Errorf("%v config format error", name)
+		}
+		for _, table := range vv {
+			tables = append(tables, pluginTable{name: name, table: table})
+		}
+	}
+	sort.SliceStable(tables, func(i, j int) bool {
+		return tables[i].table.Line < tables[j].table.Line
+	})
+	return tables, nil
 }
@@ -17,11 +17,15 @@ limitations under the License.
 package conf_test
 
 import (
+	"bytes"
 	"os"
 	"testing"
 
 	_ "github.com/openGemini/openGemini-forwarder/app/forwarder/run"
 	"github.com/openGemini/openGemini-forwarder/conf"
+	"github.com/openGemini/openGemini-forwarder/plugins/inputs/kafka"
+	"github.com/openGemini/openGemini-forwarder/plugins/outputs/openGemini"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestConfig(t *testing.T) {
@@ -33,9 +37,341 @@ func TestConfig(t *testing.T) {
 	configFile := append([]byte(pwd), "/../config/forwarder.conf"...)
 
 	c := conf.NewConfig()
-	err = conf.Parse(c, string(configFile))
+	err = conf.Parse(c, string(configFile), "")
 	if err != nil {
 		t.Fatal(err)
 	}
 	t.Log(c)
 }
+
+func parseConfig(t *testing.T, content string) (*conf.Config, error) {
+	configFile := t.TempDir() + "/forwarder.conf"
+	if err := os.WriteFile(configFile, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	c := conf.NewConfig()
+	return c, conf.Parse(c, configFile, "")
+}
+
+func TestConfigMultiplePlugins(t *testing.T) {
+	c, err := parseConfig(t, `
+[[inputs.kafka_consumer]]
+  brokers = ["127.0.0.1:9092"]
+  topics = ["a"]
+
+[[parsers.transparent]]
+
+[[inputs.kafka_consumer]]
+  brokers = ["127.0.0.1:9093"]
+  topics = ["b"]
+
+[[outputs.openGemini]]
+  urls = ["http://127.0.0.1:8086"]
+
+[[outputs.openGemini]]
+  urls = ["http://127.0.0.1:8087"]
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 2, len(c.Inputs))
+	assert.Equal(t, 1, len(c.Parsers))
+	assert.Equal(t, 2, len(c.Outputs))
+
+	input, ok := c.Inputs[1].(*kafka.Input)
+	if assert.True(t, ok) {
+		assert.Equal(t, []string{"b"}, input.Topics)
+	}
+}
+
+const pipelinePlugins = `
+[[inputs.kafka_consumer]]
+  alias = "metrics"
+  brokers = ["127.0.0.1:9092"]
+  topics = ["metrics"]
+
+[[inputs.kafka_consumer]]
+  alias = "logs"
+  brokers = ["127.0.0.1:9092"]
+  topics = ["logs"]
+
+[[parsers.transparent]]
+  alias = "metrics_parser"
+
+[[parsers.transparent]]
+  alias = "logs_parser"
+
+[[outputs.openGemini]]
+  urls = ["http://127.0.0.1:8086"]
+
+[[outputs.openGemini]]
+  alias = "archive"
+  urls = ["http://127.0.0.1:8087"]
+
+[[pipelines.metrics]]
+  inputs = ["metrics"]
+  parsers = ["metrics_parser"]
+  outputs = ["openGemini"]
+`
+
+func TestConfigPipelines(t *testing.T) {
+	c, err := parseConfig(t, pipelinePlugins+`
+[[pipelines.logs]]
+  inputs = ["logs"]
+  parsers = ["logs_parser"]
+  outputs = ["archive"]
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !assert.Equal(t, 2, len(c.Pipelines)) {
+		return
+	}
+	metrics, logs := c.Pipelines[0], c.Pipelines[1]
+	assert.Equal(t, "metrics", metrics.Name)
+	assert.Equal(t, "logs", logs.Name)
+	assert.Equal(t, "metrics", c.Alias(metrics.Inputs[0]))
+	assert.Equal(t, "logs_parser", c.Alias(logs.Parsers[0]))
+	assert.Equal(t, "openGemini", c.Alias(metrics.Outputs[0]))
+	assert.Equal(t, "archive", c.Alias(logs.Outputs[0]))
+}
+
+func TestConfigPipelinesInvalid(t *testing.T) {
+	_, err := parseConfig(t, pipelinePlugins+`
+[[pipelines.logs]]
+  inputs = ["logs"]
+  parsers = ["logs_parser"]
+  outputs = ["openGemini"]
+`)
+	assert.EqualError(t, err, `pipeline logs: output "openGemini" is already used by pipeline metrics`)
+
+	_, err = parseConfig(t, pipelinePlugins)
+	assert.EqualError(t, err, "plugin logs is not used by any pipeline")
+
+	_, err = parseConfig(t, pipelinePlugins+`
+[[pipelines.logs]]
+  inputs = ["logs"]
+  parsers = ["metrics"]
+  outputs = ["archive"]
+`)
+	assert.EqualError(t, err, `pipeline logs: undefined parser "metrics"`)
+}
+
+func TestConfigErrors(t *testing.T) {
+	_, err := parseConfig(t, `
+[[inputs.kafka_consumer]]
+  brokers = ["127.0.0.1:9092"]
+  topic = ["a"]
+
+[[outputs.openGemini]]
+  url = "http://127.0.0.1:8086"
+  databse = "db"
+
+[[outputs.influx]]
+
+[metrics]
+`)
+	assert.EqualError(t, err, `line 4: [[inputs.kafka_consumer]]: unknown key "topic"
+line 8: [[outputs.openGemini]]: unknown key "databse"
+line 10: undefined plugin [[outputs.influx]]
+line 12: unknown section [metrics]`)
+}
+
+func TestConfigValidatePlugins(t *testing.T) {
+	c, err := parseConfig(t, `
+[[inputs.kafka_consumer]]
+  brokers = ["127.0.0.1:9092"]
+  topics = ["a"]
+  offset = "latest"
+
+[[parsers.line_protocol]]
+  precision = "h"
+
+[[outputs.openGemini]]
+  url = "127.0.0.1:8086"
+  max_retries = -1
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.Validate()
+	if !assert.Error(t, err) {
+		return
+	}
+	errs, ok := err.(conf.Errors)
+	if !assert.True(t, ok) || !assert.Equal(t, 3, len(errs)) {
+		return
+	}
+	assert.Contains(t, errs[0].Error(), "line 2: [[inputs.kafka_consumer]]: ")
+	assert.Contains(t, errs[1].Error(), "line 7: [[parsers.line_protocol]]: ")
+	assert.Contains(t, errs[2].Error(), "line 10: [[outputs.openGemini]]: ")
+}
+
+func TestSample(t *testing.T) {
+	var b bytes.Buffer
+	if err := conf.Sample(&b); err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, b.String(), "[[inputs.kafka_consumer]]")
+	assert.Contains(t, b.String(), "[[parsers.json]]")
+	assert.Contains(t, b.String(), "[[outputs.openGemini]]")
+
+	c, err := parseConfig(t, b.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, c.Validate())
+}
+
+func TestConfigExpand(t *testing.T) {
+	secret := t.TempDir() + "/password"
+	if err := os.WriteFile(secret, []byte("p\"ss\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("FORWARDER_TEST_USER", "forwarder")
+	t.Setenv("FORWARDER_TEST_BATCH", "500")
+
+	c, err := parseConfig(t, `
+[[outputs.openGemini]]
+  # ${FORWARDER_TEST_UNSET} in a comment is kept
+  username = "${FORWARDER_TEST_USER}"
+  password = "@file:`+secret+`"
+  batch_size = ${FORWARDER_TEST_BATCH} # ${FORWARDER_TEST_UNSET}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := c.Outputs[0].(*openGemini.Output)
+	assert.Equal(t, "forwarder", o.Username)
+	assert.Equal(t, `p"ss`, o.Password)
+	assert.Equal(t, 500, o.BatchSize)
+	assert.Equal(t, "user ****** password ****** batch 500",
+		c.Redact(`user forwarder password p"ss batch 500`))
+}
+
+func TestConfigExpandStrings(t *testing.T) {
+	t.Setenv("FORWARDER_TEST_USER", `dom\user`)
+	t.Setenv("FORWARDER_TEST_PASS", `x"y`)
+
+	c, err := parseConfig(t, `
+[[outputs.openGemini]]
+  username = '${FORWARDER_TEST_USER}'
+  password = """
+p#${FORWARDER_TEST_PASS}"""
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := c.Outputs[0].(*openGemini.Output)
+	assert.Equal(t, `dom\user`, o.Username)
+	assert.Equal(t, `p#x"y`, o.Password)
+	assert.Equal(t, "user ****** password p#******", c.Redact(`user dom\user password p#x"y`))
+}
+
+func TestConfigExpandUnresolved(t *testing.T) {
+	_, err := parseConfig(t, `
+[[outputs.openGemini]]
+  username = "${FORWARDER_TEST_UNSET}"
+  password = "@file:/nonexistent/password"
+`)
+	assert.EqualError(t, err, `line 3: environment variable FORWARDER_TEST_UNSET is not set
+line 4: secret file: open /nonexistent/password: no such file or directory`)
+}
+
+func writeConfigs(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(dir+"/"+name, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestConfigDirectory(t *testing.T) {
+	dir := writeConfigs(t, map[string]string{
+		"main.toml": `
+[http]
+  bind-address = "127.0.0.1:8990"
+[[parsers.transparent]]
+`,
+		"10-kafka.conf": `
+[http]
+  pprof-enabled = true
+[[inputs.kafka_consumer]]
+  brokers = ["127.0.0.1:9092"]
+`,
+		"20-output.conf": `
+[[outputs.openGemini]]
+  alias = "a"
+[[outputs.openGemini]]
+  alias = "b"
+`,
+		"ignored.txt": `[unknown]`,
+	})
+
+	c := conf.NewConfig()
+	if err := conf.Parse(c, dir+"/main.toml", dir); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "127.0.0.1:8990", c.Http.BindAddress)
+	assert.True(t, c.Http.PprofEnabled)
+	assert.Equal(t, 1, len(c.Inputs))
+	assert.Equal(t, 1, len(c.Parsers))
+	if assert.Equal(t, 2, len(c.Outputs)) {
+		assert.Equal(t, "a", c.Alias(c.Outputs[0]))
+		assert.Equal(t, "b", c.Alias(c.Outputs[1]))
+	}
+}
+
+func TestConfigDirectoryConflicts(t *testing.T) {
+	dir := writeConfigs(t, map[string]string{
+		"main.toml": `
+[http]
+  bind-address = "127.0.0.1:8990"
+[[outputs.openGemini]]
+  alias = "a"
+`,
+		"10-http.conf": `
+[http]
+  bind-address = "127.0.0.1:8991"
+`,
+		"20-output.conf": `
+[[outputs.openGemini]]
+  alias = "a"
+`,
+	})
+
+	c := conf.NewConfig()
+	err := conf.Parse(c, dir+"/main.toml", dir)
+	assert.EqualError(t, err, dir+`/10-http.conf: line 3: [http]: bind-address is already set in `+dir+`/main.toml
+`+dir+`/20-output.conf: line 2: duplicate output alias "a"`)
+}
+
+func TestConfigProcessors(t *testing.T) {
+	c, err := parseConfig(t, pipelinePlugins+`
+[[processors.add_tags]]
+  [processors.add_tags.tags]
+    dc = "a"
+[[processors.drop]]
+  measurements = ["debug_*"]
+
+[[pipelines.logs]]
+  inputs = ["logs"]
+  parsers = ["logs_parser"]
+  processors = ["drop", "add_tags"]
+  outputs = ["archive"]
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 2, len(c.Processors))
+	logs := c.Pipelines[1]
+	if assert.Equal(t, 2, len(logs.Processors)) {
+		assert.Equal(t, "drop", c.Alias(logs.Processors[0]))
+		assert.Equal(t, "add_tags", c.Alias(logs.Processors[1]))
+	}
+	assert.Empty(t, c.Pipelines[0].Processors)
+	assert.NoError(t, c.Validate())
+}
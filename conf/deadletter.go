@@ -0,0 +1,80 @@
+/*
+Copyright 2022 Huawei Cloud Computing Technologies Co., Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package conf
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/influxdata/influxdb/toml"
+)
+
+const (
+	DeadLetterSinkFile  = "file"
+	DeadLetterSinkKafka = "kafka"
+
+	// DefaultDeadLetterDir is the default directory of the file sink
+	DefaultDeadLetterDir = "/opt/openGemini/dead-letter/"
+
+	// DefaultDeadLetterMaxFileSize is the size a file of the file sink is
+	// rotated at
+	DefaultDeadLetterMaxFileSize = 64 * 1024 * 1024 // 64MB
+)
+
+// DeadLetter configures where the records that failed for good are kept,
+// so that they can be replayed into their pipeline later.
+type DeadLetter struct {
+	Enabled bool `toml:"enabled"`
+	// Sink is "file" or "kafka".
+	Sink        string    `toml:"sink"`
+	Dir         string    `toml:"dir"`
+	MaxFileSize toml.Size `toml:"max-file-size"`
+	Brokers     []string  `toml:"brokers"`
+	Topic       string    `toml:"topic"`
+}
+
+func NewDeadLetter() *DeadLetter {
+	return &DeadLetter{
+		Sink:        DeadLetterSinkFile,
+		Dir:         DefaultDeadLetterDir,
+		MaxFileSize: toml.Size(DefaultDeadLetterMaxFileSize),
+	}
+}
+
+// Validate validates that the configuration is acceptable.
+func (c DeadLetter) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+
+	switch c.Sink {
+	case DeadLetterSinkFile:
+		if c.Dir == "" {
+			return errors.New("dead-letter dir must not be empty")
+		}
+		if c.MaxFileSize <= 0 {
+			return errors.New("dead-letter max-file-size must be positive")
+		}
+	case DeadLetterSinkKafka:
+		if len(c.Brokers) == 0 || c.Topic == "" {
+			return errors.New("dead-letter brokers and topic must not be empty")
+		}
+	default:
+		return fmt.Errorf("invalid dead-letter sink %q", c.Sink)
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+/*
+Copyright 2022 Huawei Cloud Computing Technologies Co., Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package conf
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/influxdata/toml"
+)
+
+// redacted replaces the secrets in the messages built from a config.
+const redacted = "******"
+
+var (
+	envRef  = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+	fileRef = regexp.MustCompile(`@file:([^"'\s]+)`)
+)
+
+// kinds of the toml strings a reference can be in
+const (
+	bare = iota
+	basicString
+	multiBasicString
+	literalString
+	multiLiteralString
+)
+
+// delimiters of the strings, the multi-line ones first.
+var delimiters = []struct {
+	quote string
+	kind  int
+}{
+	{`"""`, multiBasicString},
+	{`'''`, multiLiteralString},
+	{`"`, basicString},
+	{`'`, literalString},
+}
+
+// expand replaces the ${ENV_VAR} and @file:/path references of content with
+// the value of the variable and the content of the file, without its
+// trailing newline. Comments are left as they are. The values are escaped
+// inside basic strings and left raw elsewhere, those expanded inside a
+// string are returned as secrets.
+func expand(content []byte) ([]byte, []string, error) {
+	var (
+		errs    Errors
+		secrets []string
+	)
+	out := expandRefs(content, func(ref string, kind, line int) string {
+		value, err := resolve(ref)
+		if err != nil {
+			errs = append(errs, &toml.LineError{Line: line, Err: err})
+			return ""
+		}
+		if kind != bare && value != "" {
+			secrets = append(secrets, value)
+		}
+		if kind == basicString || kind == multiBasicString {
+			return escape(value)
+		}
+		return value
+	})
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+	return out, secrets, nil
+}
+
+// expandRefs replaces the references of content by their value, given the
+// kind of string they are in and their line. The strings are tracked
+// across the lines, so that the multi-line ones are too.
+func expandRefs(content []byte, value func(ref string, kind, line int) string) []byte {
+	var out []byte
+	kind, line := bare, 1
+	for i := 0; i < len(content); i++ {
+		rest := content[i:]
+		switch {
+		case content[i] == '\n':
+			line++
+			if kind == basicString || kind == literalString {
+				// not terminated, left to the parser
+				kind = bare
+			}
+		case content[i] == '\\' && (kind == basicString || kind == multiBasicString) && i+1 < len(content):
+			if content[i+1] == '\n' {
+				line++
+			}
+			out = append(out, content[i], content[i+1])
+			i++
+			continue
+		case content[i] == '#' && kind == bare:
+			end := bytes.IndexByte(rest, '\n')
+			if end < 0 {
+				end = len(rest)
+			}
+			out = append(out, rest[:end]...)
+			i += end - 1
+			continue
+		case content[i] == '"' || content[i] == '\'':
+			n, next := delimiter(rest, kind)
+			if n > 0 {
+				kind = next
+				out = append(out, rest[:n]...)
+				i += n - 1
+				continue
+			}
+		default:
+			if loc := envRef.FindIndex(rest); loc != nil && loc[0] == 0 {
+				out = append(out, value(string(rest[:loc[1]]), kind, line)...)
+				i += loc[1] - 1
+				continue
+			}
+			if loc := fileRef.FindIndex(rest); loc != nil && loc[0] == 0 {
+				out = append(out, value(string(rest[:loc[1]]), kind, line)...)
+				i += loc[1] - 1
+				continue
+			}
+		}
+		out = append(out, content[i])
+	}
+	return out
+}
+
+// delimiter returns the length of the delimiter rest starts with and the
+// kind of string after it, if it opens a string outside of the strings or
+// closes the string of kind. It returns 0 otherwise.
+func delimiter(rest []byte, kind int) (int, int) {
+	for _, d := range delimiters {
+		if !bytes.HasPrefix(rest, []byte(d.quote)) {
+			continue
+		}
+		switch kind {
+		case bare:
+			return len(d.quote), d.kind
+		case d.kind:
+			return len(d.quote), bare
+		}
+	}
+	return 0, kind
+}
+
+func resolve(ref string) (string, error) {
+	if m := envRef.FindStringSubmatch(ref); m != nil {
+		value, ok := os.LookupEnv(m[1])
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", m[1])
+		}
+		return value, nil
+	}
+	p := strings.TrimPrefix(ref, "@file:")
+	b, err := ioutil.ReadFile(path.Clean(p))
+	if err != nil {
+		return "", fmt.Errorf("secret file: %v", err)
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+func escape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`).Replace(s)
+}
+
+// Redact replaces the values expanded from the environment or from secret
+// files inside the strings of the config by "******" in s, it is used on
+// the messages that may quote the config.
+func (c *Config) Redact(s string) string {
+	for _, secret := range c.secrets {
+		s = strings.ReplaceAll(s, secret, redacted)
+	}
+	return s
+}
+
+func (c *Config) addSecrets(secrets []string) {
+	c.secrets = append(c.secrets, secrets...)
+	// the longest first, so that a secret containing another one is
+	// redacted as a whole
+	sort.Slice(c.secrets, func(i, j int) bool {
+		return len(c.secrets[i]) > len(c.secrets[j])
+	})
+}
@@ -22,4 +22,20 @@ const (
 	INPUT PluginType = iota
 	PARSER
 	OUTPUT
+	PROCESSOR
 )
+
+func (ty PluginType) String() string {
+	switch ty {
+	case INPUT:
+		return "input"
+	case PARSER:
+		return "parser"
+	case OUTPUT:
+		return "output"
+	case PROCESSOR:
+		return "processor"
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,133 @@
+/*
+Copyright 2022 Huawei Cloud Computing Technologies Co., Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package conf
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/influxdata/toml/ast"
+	"github.com/openGemini/openGemini-forwarder/dag/node"
+)
+
+// Pipeline is a named flow configured by a [[pipelines.<name>]] table. Its
+// inputs feed its parsers and its parsers feed its outputs.
+type Pipeline struct {
+	Name    string
+	Inputs  []node.Node
+	Parsers []node.Node
+	// Processors run in order on the records of the parsers, before the
+	// outputs.
+	Processors []node.Node
+	Outputs    []node.Node
+}
+
+// pipelineConfig is the content of a [[pipelines.<name>]] table, plugins
+// are referenced by alias.
+type pipelineConfig struct {
+	name string
+	file int
+	line int
+
+	Inputs     []string `toml:"inputs"`
+	Parsers    []string `toml:"parsers"`
+	Processors []string `toml:"processors"`
+	Outputs    []string `toml:"outputs"`
+}
+
+// parsePipelines adds the pipeline tables of the file at index file, after
+// the ones of the previous files.
+func (c *Config) parsePipelines(t *ast.Table, file int) error {
+	added := len(c.pipelines)
+	for name, v := range t.Fields {
+		vv, ok := v.([]*ast.Table)
+		if !ok || len(vv) != 1 {
+			return fmt.Errorf("pipeline %v config format error", name)
+		}
+		for _, pc := range c.pipelines[:added] {
+			if pc.name == name {
+				return fmt.Errorf("line %d: pipeline %s is already declared in %s", vv[0].Line, name, c.files[pc.file])
+			}
+		}
+		pc := &pipelineConfig{name: name, file: file, line: vv[0].Line}
+		if err := c.toml.UnmarshalTable(vv[0], pc); err != nil {
+			return err
+		}
+		c.pipelines = append(c.pipelines, pc)
+	}
+	sort.Slice(c.pipelines[added:], func(i, j int) bool {
+		return c.pipelines[added+i].line < c.pipelines[added+j].line
+	})
+	return nil
+}
+
+// resolvePipelines looks up the plugins referenced by the pipeline tables.
+// Every plugin must belong to exactly one pipeline.
+func (c *Config) resolvePipelines() error {
+	if len(c.pipelines) == 0 {
+		return nil
+	}
+
+	owner := make(map[node.Node]string)
+	resolve := func(pc *pipelineConfig, aliases []string, ty PluginType) ([]node.Node, error) {
+		kind := ty.String()
+		nodes := make([]node.Node, 0, len(aliases))
+		for _, alias := range aliases {
+			found := c.aliases[ty][alias]
+			if len(found) == 0 {
+				return nil, fmt.Errorf("pipeline %s: undefined %s %q", pc.name, kind, alias)
+			}
+			if len(found) > 1 {
+				return nil, fmt.Errorf("pipeline %s: %s %q is ambiguous, set an alias on the plugins", pc.name, kind, alias)
+			}
+			n := found[0]
+			if p, ok := owner[n]; ok {
+				return nil, fmt.Errorf("pipeline %s: %s %q is already used by pipeline %s", pc.name, kind, alias, p)
+			}
+			owner[n] = pc.name
+			nodes = append(nodes, n)
+		}
+		return nodes, nil
+	}
+
+	for _, pc := range c.pipelines {
+		p := &Pipeline{Name: pc.name}
+		var err error
+		if p.Inputs, err = resolve(pc, pc.Inputs, INPUT); err != nil {
+			return err
+		}
+		if p.Parsers, err = resolve(pc, pc.Parsers, PARSER); err != nil {
+			return err
+		}
+		if p.Processors, err = resolve(pc, pc.Processors, PROCESSOR); err != nil {
+			return err
+		}
+		if p.Outputs, err = resolve(pc, pc.Outputs, OUTPUT); err != nil {
+			return err
+		}
+		c.Pipelines = append(c.Pipelines, p)
+	}
+
+	for _, nodes := range [][]node.Node{c.Inputs, c.Parsers, c.Processors, c.Outputs} {
+		for _, n := range nodes {
+			if _, ok := owner[n]; !ok {
+				return fmt.Errorf("plugin %s is not used by any pipeline", c.Alias(n))
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+/*
+Copyright 2022 Huawei Cloud Computing Technologies Co., Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package conf
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/openGemini/openGemini-forwarder/dag/node"
+	"github.com/openGemini/openGemini-forwarder/plugins/inputs"
+	"github.com/openGemini/openGemini-forwarder/plugins/outputs"
+	"github.com/openGemini/openGemini-forwarder/plugins/parsers"
+	"github.com/openGemini/openGemini-forwarder/plugins/processors"
+)
+
+// Sample writes the sample config of every registered input, parser,
+// processor and output, sorted by name. A plugin that is not a node.Sampler is written
+// as an empty table.
+func Sample(w io.Writer) error {
+	kinds := []struct {
+		ty       PluginType
+		creators map[string]node.Creator
+	}{
+		{INPUT, inputs.GetInputs()},
+		{PARSER, parsers.GetParsers()},
+		{PROCESSOR, processors.GetProcessors()},
+		{OUTPUT, outputs.GetOutputs()},
+	}
+
+	var samples []string
+	for _, k := range kinds {
+		names := make([]string, 0, len(k.creators))
+		for name := range k.creators {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			s, ok := k.creators[name]().(node.Sampler)
+			if !ok {
+				samples = append(samples, fmt.Sprintf("[[%ss.%s]]\n", k.ty, name))
+				continue
+			}
+			samples = append(samples, s.SampleConfig())
+		}
+	}
+	_, err := io.WriteString(w, strings.Join(samples, "\n"))
+	return err
+}
@@ -18,88 +18,632 @@ package dag
 
 import (
 	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"time"
 
 	"github.com/openGemini/openGemini-forwarder/conf"
 	nodeModel "github.com/openGemini/openGemini-forwarder/dag/node"
 	"github.com/openGemini/openGemini-forwarder/edge"
+	"github.com/openGemini/openGemini-forwarder/lib/deadletter"
+	"github.com/openGemini/openGemini-forwarder/lib/logger"
+	"github.com/openGemini/openGemini-forwarder/lib/metrics"
+	"github.com/openGemini/openGemini-forwarder/plugins/parsers"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
 )
 
 var (
 	DefaultEdgeSize = 10
+
+	// DefaultDrainTimeout bounds how long stopping a pipeline waits for the
+	// records queued on its edges.
+	DefaultDrainTimeout = 30 * time.Second
 )
 
+const drainInterval = 10 * time.Millisecond
+
+var edgeLenDesc = metrics.NewDesc("edge_queue_length", "Records queued on an edge.", []string{"pipeline", "edge"})
+
+// DefaultPipeline is the name of the pipeline built when the config does
+// not declare any.
+const DefaultPipeline = "default"
+
+// Dag is the graph of plugin nodes built from the config. It runs one
+// pipeline per [[pipelines.<name>]] table, or a single "default" pipeline
+// made of all plugins when the config declares none.
 type Dag struct {
-	root *node
+	mu         sync.RWMutex
+	pipelines  []*Pipeline
+	deadLetter deadletter.Writer
+}
+
+// pipelineConfigs returns the pipelines declared by c, or the default one.
+func pipelineConfigs(c *conf.Config) []*conf.Pipeline {
+	if len(c.Pipelines) > 0 {
+		return c.Pipelines
+	}
+	return []*conf.Pipeline{{
+		Name:       DefaultPipeline,
+		Inputs:     c.Inputs,
+		Parsers:    c.Parsers,
+		Processors: c.Processors,
+		Outputs:    c.Outputs,
+	}}
 }
 
 func NewDag(c *conf.Config) (*Dag, error) {
-	inputs := c.Inputs
-	parsers := c.Parsers
-	outputs := c.Outputs
-	if len(inputs) != 1 || len(parsers) != 1 || len(outputs) != 1 {
-		return nil, errors.New("inputs or parsers or outputs more than one")
+	d := &Dag{}
+	for _, pc := range pipelineConfigs(c) {
+		p, err := newPipeline(c, pc)
+		if err != nil {
+			return nil, fmt.Errorf("pipeline %s: %v", pc.Name, err)
+		}
+		d.setDropped(p)
+		d.pipelines = append(d.pipelines, p)
 	}
+	return d, nil
+}
 
-	var input *node
-	for i := range inputs {
-		input = &node{n: inputs[i], name: inputs[i].Name()}
+func (d *Dag) Init() error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for _, p := range d.pipelines {
+		if err := p.Init(); err != nil {
+			return err
+		}
 	}
-	var parser *node
-	for i := range parsers {
-		parser = &node{n: parsers[i], name: parsers[i].Name()}
+	return nil
+}
+
+func (d *Dag) Start() error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for _, p := range d.pipelines {
+		if err := p.Start(); err != nil {
+			return err
+		}
 	}
-	var output *node
-	for i := range outputs {
-		output = &node{n: outputs[i], name: outputs[i].Name()}
+	return nil
+}
+
+// Stop drains and stops all pipelines concurrently.
+func (d *Dag) Stop() error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	errs := make([]error, len(d.pipelines))
+	var wg sync.WaitGroup
+	for i, p := range d.pipelines {
+		wg.Add(1)
+		go func(i int, p *Pipeline) {
+			defer wg.Done()
+			errs[i] = p.Stop()
+		}(i, p)
 	}
+	wg.Wait()
 
-	input.LinkChild(parser, DefaultEdgeSize)
-	parser.LinkChild(output, DefaultEdgeSize)
-	dag := &Dag{root: input}
-	return dag, nil
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func (d Dag) Init() error {
-	return d.root.Init()
+// SetDeadLetter hands w to the inputs that can write the records failed for
+// good to it, tagged with their pipeline.
+func (d *Dag) SetDeadLetter(w deadletter.Writer) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.deadLetter = w
+	for _, p := range d.pipelines {
+		for _, n := range p.inputs {
+			d.setDeadLetter(p, n.n)
+		}
+		d.setDropped(p)
+	}
 }
 
-func (d Dag) Start() {
-	d.root.Start()
+func (d *Dag) setDeadLetter(p *Pipeline, n nodeModel.Node) {
+	if u, ok := n.(deadletter.User); ok && d.deadLetter != nil {
+		u.SetDeadLetter(deadletter.ForPipeline(d.deadLetter, p.name))
+	}
 }
 
-type node struct {
-	parent *node
-	child  *node
-	in     edge.Edge
-	out    edge.Edge
-	n      nodeModel.Node
-	name   string
+// setDropped makes the disk edges of p write the records their outputs
+// failed for good to the dead letters, or log and count them if there are
+// none. So do the parsers of p with the invalid parts of their records.
+func (d *Dag) setDropped(p *Pipeline) {
+	w := d.pipelineDeadLetter(p)
+	for _, e := range p.edges {
+		if de, ok := e.(*edge.DiskEdge); ok {
+			de.SetDropped(dropped(de.Name(), w))
+		}
+	}
+	for _, n := range p.parsers {
+		setRejected(n.name, n.n, w)
+	}
+}
+
+func (d *Dag) pipelineDeadLetter(p *Pipeline) deadletter.Writer {
+	if d.deadLetter == nil {
+		return nil
+	}
+	return deadletter.ForPipeline(d.deadLetter, p.name)
+}
+
+func setRejected(name string, n nodeModel.Node, w deadletter.Writer) {
+	if r, ok := n.(parsers.Rejecter); ok {
+		r.SetRejected(dropped(name, w))
+	}
+}
+
+func dropped(name string, w deadletter.Writer) func(r *edge.Record, err error) {
+	return func(r *edge.Record, err error) {
+		if w != nil {
+			werr := w.Write(deadletter.NewItem(r, err))
+			if werr == nil {
+				return
+			}
+			logger.NewLogger("dag").Error("write dead letter fail", zap.String("node", name), zap.Error(werr))
+		}
+		metrics.NodeRecords.WithLabelValues(name, metrics.Dropped).Inc()
+		src := r.Source
+		logger.NewLogger("dag").Error("drop record failed for good", zap.String("node", name),
+			zap.String("topic", src.Topic), zap.Int32("partition", src.Partition),
+			zap.Int64("offset", src.Offset), zap.Error(err))
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (d *Dag) Describe(ch chan<- *prometheus.Desc) {
+	ch <- edgeLenDesc
 }
 
-func (n *node) Start() {
-	n.n.Start(n.in, n.out)
-	if n.child != nil {
-		n.child.Start()
+// Collect implements prometheus.Collector, it reports the queue length of
+// every edge.
+func (d *Dag) Collect(ch chan<- prometheus.Metric) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for _, p := range d.pipelines {
+		for _, e := range p.edges {
+			ch <- prometheus.MustNewConstMetric(edgeLenDesc, prometheus.GaugeValue, float64(e.Len()), p.name, e.Name())
+		}
 	}
 }
 
-func (n *node) Init() error {
-	err := n.n.Init()
+// Status is the status of a component of a pipeline, a node or an edge.
+type Status struct {
+	Pipeline  string `json:"pipeline"`
+	Component string `json:"component"`
+	Healthy   bool   `json:"healthy"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Health returns the status of every pipeline, a pipeline is healthy while
+// it runs.
+func (d *Dag) Health() []Status {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	statuses := make([]Status, 0, len(d.pipelines))
+	for _, p := range d.pipelines {
+		statuses = append(statuses, p.health())
+	}
+	return statuses
+}
+
+// Ready returns the status of every pipeline, of its nodes that implement
+// node.Checker and of its edges. An edge is unhealthy while it is full,
+// that is while it blocks its writers.
+func (d *Dag) Ready() []Status {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	var statuses []Status
+	for _, p := range d.pipelines {
+		statuses = append(statuses, p.health())
+		for _, n := range p.nodes {
+			if c, ok := n.n.(nodeModel.Checker); ok {
+				statuses = append(statuses, newStatus(p.name, n.name, c.Check()))
+			}
+		}
+		for _, e := range p.edges {
+			var err error
+			if in := e.In(); cap(in) > 0 && len(in) == cap(in) {
+				err = errors.New("edge is full")
+			}
+			statuses = append(statuses, newStatus(p.name, e.Name(), err))
+		}
+	}
+	return statuses
+}
+
+func newStatus(pipeline string, component string, err error) Status {
+	s := Status{Pipeline: pipeline, Component: component, Healthy: err == nil}
 	if err != nil {
-		return err
+		s.Error = err.Error()
 	}
-	if n.child != nil {
-		err = n.child.Init()
-		if err != nil {
-			return err
+	return s
+}
+
+// Pipelines returns the pipelines in config order.
+func (d *Dag) Pipelines() []*Pipeline {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.pipelines
+}
+
+// Handler returns the input of the dag serving pattern on the forwarder
+// listener, or nil.
+func (d *Dag) Handler(pattern string) http.Handler {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for _, p := range d.pipelines {
+		for _, n := range p.inputs {
+			if h, ok := n.n.(nodeModel.Handler); ok && h.Pattern() == pattern {
+				return h
+			}
 		}
 	}
 	return nil
 }
 
-func (n *node) LinkChild(child *node, cacheSize int) {
-	edge := edge.NewEdge(n.name, cacheSize)
-	n.out = edge
-	child.in = edge
-	n.child = child
+// Patterns returns the paths the inputs of the dag serve on the forwarder
+// listener.
+func (d *Dag) Patterns() []string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	var patterns []string
+	for _, p := range d.pipelines {
+		for _, n := range p.inputs {
+			if h, ok := n.n.(nodeModel.Handler); ok && h.Pattern() != "" {
+				patterns = append(patterns, h.Pattern())
+			}
+		}
+	}
+	return patterns
+}
+
+// Pipeline returns the pipeline with the given name, or nil.
+func (d *Dag) Pipeline(name string) *Pipeline {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for _, p := range d.pipelines {
+		if p.name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// Pipeline is one flow of the dag. Every input feeds the parsers through
+// one shared edge, so the parsers share the load and each record is parsed
+// by one of them. The records of the parsers go through the processors one
+// after the other, then the last stage hands a copy of every record to each
+// output through a broadcast edge. Pipelines own their edges and are
+// started and stopped independently.
+type Pipeline struct {
+	name string
+	// nodes is sorted so that every node comes after its parents.
+	nodes []*node
+	edges []edge.Edge
+	// the nodes of each kind, in config order
+	inputs     []*node
+	parsers    []*node
+	processors []*node
+	outputs    []*node
+
+	mu      sync.Mutex
+	running bool
+}
+
+func newPipeline(c *conf.Config, pc *conf.Pipeline) (*Pipeline, error) {
+	inputs := newNodes(c, pc.Inputs)
+	parsers := newNodes(c, pc.Parsers)
+	processors := newNodes(c, pc.Processors)
+	outputs := newNodes(c, pc.Outputs)
+	if len(inputs) == 0 || len(parsers) == 0 || len(outputs) == 0 {
+		return nil, errors.New("inputs, parsers and outputs must not be empty")
+	}
+
+	branches, err := outputEdges(c, pc.Name, outputs)
+	if err != nil {
+		return nil, err
+	}
+	edges := []edge.Edge{link(inputs, parsers, edge.NewEdge(pc.Name+".inputs", DefaultEdgeSize))}
+	// each edge is named after the stage writing to it
+	last, lastName := parsers, "parsers"
+	for _, proc := range processors {
+		edges = append(edges, link(last, []*node{proc}, edge.NewEdge(pc.Name+"."+lastName, DefaultEdgeSize)))
+		last, lastName = []*node{proc}, proc.name
+	}
+	edges = append(edges, broadcast(pc.Name+"."+lastName, last, outputs, branches)...)
+
+	var nodes []*node
+	nodes = append(nodes, inputs...)
+	nodes = append(nodes, parsers...)
+	nodes = append(nodes, processors...)
+	nodes = append(nodes, outputs...)
+	sorted, err := sortNodes(nodes)
+	if err != nil {
+		for _, e := range edges {
+			if c, ok := e.(io.Closer); ok {
+				_ = c.Close()
+			}
+		}
+		return nil, err
+	}
+	return &Pipeline{
+		name:       pc.Name,
+		nodes:      sorted,
+		edges:      edges,
+		inputs:     inputs,
+		parsers:    parsers,
+		processors: processors,
+		outputs:    outputs,
+	}, nil
+}
+
+func (p *Pipeline) Name() string {
+	return p.name
+}
+
+func (p *Pipeline) health() Status {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var err error
+	if !p.running {
+		err = errors.New("pipeline is not running")
+	}
+	return newStatus(p.name, "pipeline", err)
+}
+
+func (p *Pipeline) Init() error {
+	for _, n := range p.nodes {
+		if err := n.n.Init(); err != nil {
+			return fmt.Errorf("pipeline %s: init %s: %v", p.name, n.name, err)
+		}
+	}
+	return nil
+}
+
+// Start opens the edges closed by a previous Stop, then starts the nodes
+// from the outputs back to the inputs, so that no node produces records
+// before its children are consuming. If a node fails to start, the nodes
+// already started are stopped again.
+func (p *Pipeline) Start() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.running {
+		return nil
+	}
+
+	for _, e := range p.edges {
+		if o, ok := e.(opener); ok {
+			if err := o.Open(); err != nil {
+				return fmt.Errorf("pipeline %s: open edge: %v", p.name, err)
+			}
+		}
+	}
+
+	for i := len(p.nodes) - 1; i >= 0; i-- {
+		n := p.nodes[i]
+		if err := n.n.Start(n.in, n.out); err != nil {
+			for _, started := range p.nodes[i+1:] {
+				_ = started.n.Stop()
+			}
+			return fmt.Errorf("pipeline %s: start %s: %v", p.name, n.name, err)
+		}
+	}
+	p.running = true
+	return nil
+}
+
+// Stop drains the pipeline. The inputs are paused first, then every node is
+// stopped once the records queued in front of it are consumed or the drain
+// timeout expires, so that outputs flush what the inputs already emitted.
+// Paused inputs are stopped last, after their records have been delivered.
+func (p *Pipeline) Stop() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.running {
+		return nil
+	}
+	p.running = false
+
+	var errs []error
+	deadline := time.Now().Add(DefaultDrainTimeout)
+	var paused []*node
+	for _, n := range p.nodes {
+		if len(n.parents) == 0 {
+			if pauser, ok := n.n.(nodeModel.Pauser); ok {
+				if err := pauser.Pause(); err == nil {
+					paused = append(paused, n)
+					continue
+				}
+			}
+		} else if left := n.drain(deadline); left > 0 {
+			errs = append(errs, fmt.Errorf("drain %s timed out, %d records left", n.name, left))
+		}
+		if err := n.n.Stop(); err != nil {
+			errs = append(errs, fmt.Errorf("stop %s: %v", n.name, err))
+		}
+	}
+	for _, n := range paused {
+		if err := n.n.Stop(); err != nil {
+			errs = append(errs, fmt.Errorf("stop %s: %v", n.name, err))
+		}
+	}
+	for _, e := range p.edges {
+		if c, ok := e.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("close edge: %v", err))
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("pipeline %s: %v", p.name, errs)
+	}
+	return nil
+}
+
+// opener is implemented by edges that are closed by Stop and must be opened
+// again before the pipeline is restarted.
+type opener interface {
+	Open() error
+}
+
+type node struct {
+	parents  []*node
+	children []*node
+	in       edge.Edge
+	out      edge.Edge
+	n        nodeModel.Node
+	name     string
+	// digest identifies the config of n
+	digest string
+}
+
+func newNodes(c *conf.Config, ns []nodeModel.Node) []*node {
+	nodes := make([]*node, 0, len(ns))
+	for i := range ns {
+		nodes = append(nodes, &node{n: ns[i], name: c.Alias(ns[i]), digest: c.Digest(ns[i])})
+		setAlias(ns[i], c.Alias(ns[i]))
+	}
+	return nodes
+}
+
+func setAlias(n nodeModel.Node, alias string) {
+	if a, ok := n.(nodeModel.Aliaser); ok {
+		a.SetAlias(alias)
+	}
+}
+
+// outputEdges returns the edges the outputs read from, in memory or, with
+// the disk buffer enabled, on disk under <dir>/<pipeline>/<output>.
+func outputEdges(c *conf.Config, pipeline string, outputs []*node) ([]edge.Edge, error) {
+	edges := make([]edge.Edge, 0, len(outputs))
+	seen := make(map[string]int, len(outputs))
+	for _, o := range outputs {
+		name := pipeline + "." + o.name
+		if !c.DiskBuffer.Enabled {
+			edges = append(edges, edge.NewEdge(name, DefaultEdgeSize))
+			continue
+		}
+
+		dir := o.name
+		if seen[o.name]++; seen[o.name] > 1 {
+			dir = fmt.Sprintf("%s-%d", o.name, seen[o.name])
+		}
+		e, err := edge.NewDiskEdge(name, DefaultEdgeSize, filepath.Join(c.DiskBuffer.Dir, pipeline, dir),
+			int64(c.DiskBuffer.MaxSize), int64(c.DiskBuffer.SegmentSize))
+		if err != nil {
+			for _, opened := range edges {
+				_ = opened.(io.Closer).Close()
+			}
+			return nil, err
+		}
+		edges = append(edges, e)
+	}
+	return edges, nil
+}
+
+// link connects every parent to every child through one shared edge, each
+// record is read by one of the children.
+func link(parents, children []*node, e edge.Edge) edge.Edge {
+	for _, p := range parents {
+		p.out = e
+		p.children = append(p.children, children...)
+	}
+	for _, c := range children {
+		c.in = e
+		c.parents = append(c.parents, parents...)
+	}
+	return e
+}
+
+// broadcast connects every parent to every child so that each child reads
+// every record from its branch. It returns the edges it links through.
+func broadcast(name string, parents, children []*node, branches []edge.Edge) []edge.Edge {
+	if len(children) < 2 {
+		return []edge.Edge{link(parents, children, branches[0])}
+	}
+
+	e := edge.NewBroadcastEdgeTo(name, DefaultEdgeSize, branches)
+	for _, p := range parents {
+		p.out = e
+		p.children = append(p.children, children...)
+	}
+	for i, c := range children {
+		c.in = e.Branch(i)
+		c.parents = append(c.parents, parents...)
+	}
+	return append([]edge.Edge{e}, branches...)
+}
+
+// sortNodes checks the graph and returns its nodes in topological order.
+// Every node must be linked and the graph must not contain a cycle.
+func sortNodes(nodes []*node) ([]*node, error) {
+	degree := make(map[*node]int, len(nodes))
+	var queue []*node
+	for _, n := range nodes {
+		if len(n.parents) == 0 && len(n.children) == 0 {
+			return nil, fmt.Errorf("node %s is not linked", n.name)
+		}
+		degree[n] = len(n.parents)
+		if len(n.parents) == 0 {
+			queue = append(queue, n)
+		}
+	}
+
+	sorted := make([]*node, 0, len(nodes))
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		sorted = append(sorted, n)
+		for _, c := range n.children {
+			if _, ok := degree[c]; !ok {
+				return nil, fmt.Errorf("node %s links to unknown node %s", n.name, c.name)
+			}
+			degree[c]--
+			if degree[c] == 0 {
+				queue = append(queue, c)
+			}
+		}
+	}
+	if len(sorted) != len(nodes) {
+		return nil, errors.New("dag contains a cycle")
+	}
+	return sorted, nil
+}
+
+// flusher is implemented by edges that hold records outside of the queues
+// counted by Len.
+type flusher interface {
+	Flush(deadline time.Time) bool
+}
+
+// drain waits until the edges feeding n are empty or the deadline expires,
+// it returns the number of records left. The parents of n are stopped.
+func (n *node) drain(deadline time.Time) int {
+	for _, p := range n.parents {
+		if f, ok := p.out.(flusher); ok {
+			f.Flush(deadline)
+		}
+	}
+	for {
+		left := n.in.Len()
+		for _, p := range n.parents {
+			if p.out != n.in {
+				left += p.out.Len()
+			}
+		}
+		if left == 0 || time.Now().After(deadline) {
+			return left
+		}
+		time.Sleep(drainInterval)
+	}
 }
@@ -0,0 +1,432 @@
+/*
+Copyright 2022 Huawei Cloud Computing Technologies Co., Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dag_test
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/openGemini/openGemini-forwarder/conf"
+	"github.com/openGemini/openGemini-forwarder/dag"
+	"github.com/openGemini/openGemini-forwarder/dag/node"
+	"github.com/openGemini/openGemini-forwarder/edge"
+	"github.com/openGemini/openGemini-forwarder/lib/deadletter"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeNode struct {
+	name    string
+	started *[]string
+	in      edge.Edge
+	out     edge.Edge
+}
+
+func (n *fakeNode) Init() error  { return nil }
+func (n *fakeNode) Stop() error  { return nil }
+func (n *fakeNode) Name() string { return n.name }
+
+func (n *fakeNode) Start(in edge.Edge, out edge.Edge) error {
+	n.in, n.out = in, out
+	*n.started = append(*n.started, n.name)
+	return nil
+}
+
+func TestNewDag(t *testing.T) {
+	var started []string
+	newNode := func(name string) *fakeNode {
+		return &fakeNode{name: name, started: &started}
+	}
+	in1, in2 := newNode("in1"), newNode("in2")
+	parser := newNode("parser")
+	out1, out2 := newNode("out1"), newNode("out2")
+
+	c := conf.NewConfig()
+	c.Inputs = []node.Node{in1, in2}
+	c.Parsers = []node.Node{parser}
+	c.Outputs = []node.Node{out1, out2}
+
+	d, err := dag.NewDag(c)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, d.Init())
+	assert.NoError(t, d.Start())
+
+	assert.Equal(t, []string{"out2", "out1", "parser", "in2", "in1"}, started)
+	assert.Nil(t, in1.in)
+	assert.Same(t, in1.out, in2.out)
+	assert.Same(t, in1.out, parser.in)
+	broadcast, ok := parser.out.(*edge.BroadcastEdge)
+	if assert.True(t, ok) {
+		assert.Same(t, broadcast.Branch(0), out1.in)
+		assert.Same(t, broadcast.Branch(1), out2.in)
+	}
+	assert.Nil(t, out1.out)
+	// the queue length of the inputs and parsers edges, and of the branches
+	assert.Equal(t, 4, testutil.CollectAndCount(d))
+}
+
+func TestNewDagProcessors(t *testing.T) {
+	var started []string
+	newNode := func(name string) *fakeNode {
+		return &fakeNode{name: name, started: &started}
+	}
+	in, parser := newNode("in"), newNode("parser")
+	proc1, proc2 := newNode("proc1"), newNode("proc2")
+	out1, out2 := newNode("out1"), newNode("out2")
+
+	c := conf.NewConfig()
+	c.Inputs = []node.Node{in}
+	c.Parsers = []node.Node{parser}
+	c.Processors = []node.Node{proc1, proc2}
+	c.Outputs = []node.Node{out1, out2}
+
+	d, err := dag.NewDag(c)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, d.Init())
+	assert.NoError(t, d.Start())
+
+	defer d.Stop()
+
+	// the processors are chained between the parser and the broadcast to
+	// the outputs
+	assert.Equal(t, []string{"out2", "out1", "proc2", "proc1", "parser", "in"}, started)
+	assert.Same(t, parser.out, proc1.in)
+	assert.Same(t, proc1.out, proc2.in)
+	assert.Equal(t, "default.parsers", proc1.in.Name())
+	assert.Equal(t, "default.proc1", proc2.in.Name())
+	broadcast, ok := proc2.out.(*edge.BroadcastEdge)
+	if assert.True(t, ok) {
+		assert.Equal(t, "default.proc2", broadcast.Name())
+		assert.Same(t, broadcast.Branch(0), out1.in)
+		assert.Same(t, broadcast.Branch(1), out2.in)
+	}
+
+	record := &edge.Record{Payload: []byte("m v=1")}
+	proc2.out.In() <- record
+	assert.Same(t, record, <-out1.in.Out())
+	assert.Same(t, record, <-out2.in.Out())
+}
+
+func TestNewDagEmptyStage(t *testing.T) {
+	var started []string
+	c := conf.NewConfig()
+	c.Inputs = []node.Node{&fakeNode{name: "in", started: &started}}
+	c.Outputs = []node.Node{&fakeNode{name: "out", started: &started}}
+
+	_, err := dag.NewDag(c)
+	assert.Error(t, err)
+}
+
+func TestNewDagPipelines(t *testing.T) {
+	var started []string
+	newNode := func(name string) *fakeNode {
+		return &fakeNode{name: name, started: &started}
+	}
+	in1, parser1, out1 := newNode("in1"), newNode("parser1"), newNode("out1")
+	in2, parser2, out2 := newNode("in2"), newNode("parser2"), newNode("out2")
+
+	c := conf.NewConfig()
+	c.Pipelines = []*conf.Pipeline{
+		{Name: "a", Inputs: []node.Node{in1}, Parsers: []node.Node{parser1}, Outputs: []node.Node{out1}},
+		{Name: "b", Inputs: []node.Node{in2}, Parsers: []node.Node{parser2}, Outputs: []node.Node{out2}},
+	}
+
+	d, err := dag.NewDag(c)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 2, len(d.Pipelines()))
+	assert.Nil(t, d.Pipeline(dag.DefaultPipeline))
+
+	b := d.Pipeline("b")
+	assert.NoError(t, b.Init())
+	assert.NoError(t, b.Start())
+	assert.Equal(t, []string{"out2", "parser2", "in2"}, started)
+	assert.Nil(t, in1.out)
+	assert.Nil(t, parser1.in)
+	assert.Same(t, in2.out, parser2.in)
+	assert.Same(t, parser2.out, out2.in)
+	assert.NoError(t, b.Stop())
+}
+
+// pipeNode forwards records from in to out, or counts them when it has no
+// out edge, and logs its lifecycle to events.
+type pipeNode struct {
+	name     string
+	events   *[]string
+	emit     int
+	received int
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func (n *pipeNode) Init() error  { return nil }
+func (n *pipeNode) Name() string { return n.name }
+
+func (n *pipeNode) Start(in edge.Edge, out edge.Edge) error {
+	n.stop = make(chan struct{})
+	n.done = make(chan struct{})
+	for i := 0; i < n.emit; i++ {
+		out.In() <- &edge.Record{}
+	}
+	go func() {
+		defer close(n.done)
+		if in == nil {
+			<-n.stop
+			return
+		}
+		for {
+			select {
+			case <-n.stop:
+				return
+			case r := <-in.Out():
+				time.Sleep(time.Millisecond)
+				if out != nil {
+					out.In() <- r
+				} else {
+					n.received++
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+func (n *pipeNode) Stop() error {
+	close(n.stop)
+	<-n.done
+	*n.events = append(*n.events, "stop "+n.name)
+	return nil
+}
+
+type pausingNode struct {
+	pipeNode
+}
+
+func (n *pausingNode) Pause() error {
+	*n.events = append(*n.events, "pause "+n.name)
+	return nil
+}
+
+func TestPipelineStopDrains(t *testing.T) {
+	var events []string
+	in := &pausingNode{pipeNode{name: "in", events: &events, emit: 8}}
+	parser := &pipeNode{name: "parser", events: &events}
+	out1 := &pipeNode{name: "out1", events: &events}
+	out2 := &pipeNode{name: "out2", events: &events}
+
+	c := conf.NewConfig()
+	c.Inputs = []node.Node{in}
+	c.Parsers = []node.Node{parser}
+	c.Outputs = []node.Node{out1, out2}
+
+	defer func(size int) { dag.DefaultEdgeSize = size }(dag.DefaultEdgeSize)
+	dag.DefaultEdgeSize = 8
+	d, err := dag.NewDag(c)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, d.Init())
+	assert.NoError(t, d.Start())
+	assert.NoError(t, d.Stop())
+
+	assert.Equal(t, []string{"pause in", "stop parser", "stop out1", "stop out2", "stop in"}, events)
+	assert.Equal(t, 8, out1.received)
+	assert.Equal(t, 8, out2.received)
+}
+
+func TestPipelineRestart(t *testing.T) {
+	var events []string
+	in := &pausingNode{pipeNode{name: "in", events: &events, emit: 4}}
+	parser := &pipeNode{name: "parser", events: &events}
+	out1 := &pipeNode{name: "out1", events: &events}
+	out2 := &pipeNode{name: "out2", events: &events}
+
+	c := conf.NewConfig()
+	c.Inputs = []node.Node{in}
+	c.Parsers = []node.Node{parser}
+	c.Outputs = []node.Node{out1, out2}
+
+	defer func(size int) { dag.DefaultEdgeSize = size }(dag.DefaultEdgeSize)
+	dag.DefaultEdgeSize = 4
+	d, err := dag.NewDag(c)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, d.Init())
+	for i := 1; i <= 2; i++ {
+		assert.NoError(t, d.Start())
+		assert.NoError(t, d.Stop())
+		assert.Equal(t, 4*i, out1.received)
+		assert.Equal(t, 4*i, out2.received)
+	}
+}
+
+func TestNewDagDiskBuffer(t *testing.T) {
+	var started []string
+	newNode := func(name string) *fakeNode {
+		return &fakeNode{name: name, started: &started}
+	}
+	in, parser := newNode("in"), newNode("parser")
+	out1, out2 := newNode("out"), newNode("out")
+
+	c := conf.NewConfig()
+	c.Inputs = []node.Node{in}
+	c.Parsers = []node.Node{parser}
+	c.Outputs = []node.Node{out1, out2}
+	c.DiskBuffer.Enabled = true
+	c.DiskBuffer.Dir = t.TempDir()
+
+	d, err := dag.NewDag(c)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, d.Init())
+	assert.NoError(t, d.Start())
+	_, ok := out1.in.(*edge.DiskEdge)
+	assert.True(t, ok)
+	_, ok = out2.in.(*edge.DiskEdge)
+	assert.True(t, ok)
+	assert.DirExists(t, filepath.Join(c.DiskBuffer.Dir, dag.DefaultPipeline, "out"))
+	assert.DirExists(t, filepath.Join(c.DiskBuffer.Dir, dag.DefaultPipeline, "out-2"))
+	assert.NoError(t, d.Stop())
+}
+
+type itemWriter chan *deadletter.Item
+
+func (w itemWriter) Write(item *deadletter.Item) error {
+	w <- item
+	return nil
+}
+
+func TestDiskBufferDeadLetter(t *testing.T) {
+	var started []string
+	in, parser, out := &fakeNode{name: "in", started: &started},
+		&fakeNode{name: "parser", started: &started}, &fakeNode{name: "out", started: &started}
+
+	c := conf.NewConfig()
+	c.Inputs = []node.Node{in}
+	c.Parsers = []node.Node{parser}
+	c.Outputs = []node.Node{out}
+	c.DiskBuffer.Enabled = true
+	c.DiskBuffer.Dir = t.TempDir()
+
+	d, err := dag.NewDag(c)
+	if !assert.NoError(t, err) {
+		return
+	}
+	w := make(itemWriter, 1)
+	d.SetDeadLetter(w)
+	assert.NoError(t, d.Init())
+	assert.NoError(t, d.Start())
+	defer d.Stop()
+
+	parser.out.In() <- &edge.Record{Payload: []byte("cpu value=1")}
+	r := <-out.in.Out()
+	r.Nack(edge.WithStage("out", edge.Permanent(errors.New("bad request"))))
+	item := <-w
+	assert.Equal(t, dag.DefaultPipeline, item.Pipeline)
+	assert.Equal(t, "out", item.Stage)
+	assert.Equal(t, "cpu value=1", string(item.Payload))
+}
+
+type rejectingNode struct {
+	fakeNode
+	rejected func(r *edge.Record, err error)
+}
+
+func (n *rejectingNode) SetRejected(fn func(r *edge.Record, err error)) { n.rejected = fn }
+
+func TestParserDeadLetter(t *testing.T) {
+	var started []string
+	in, out := &fakeNode{name: "in", started: &started}, &fakeNode{name: "out", started: &started}
+	parser := &rejectingNode{fakeNode: fakeNode{name: "parser", started: &started}}
+
+	c := conf.NewConfig()
+	c.Inputs = []node.Node{in}
+	c.Parsers = []node.Node{parser}
+	c.Outputs = []node.Node{out}
+
+	d, err := dag.NewDag(c)
+	if !assert.NoError(t, err) {
+		return
+	}
+	w := make(itemWriter, 1)
+	d.SetDeadLetter(w)
+	if !assert.NotNil(t, parser.rejected) {
+		return
+	}
+	parser.rejected(&edge.Record{Payload: []byte("invalid")}, edge.WithStage("parser", errors.New("bad line")))
+	item := <-w
+	assert.Equal(t, dag.DefaultPipeline, item.Pipeline)
+	assert.Equal(t, "parser", item.Stage)
+	assert.Equal(t, "invalid", string(item.Payload))
+}
+
+type checkingNode struct {
+	fakeNode
+	err error
+}
+
+func (n *checkingNode) Check() error { return n.err }
+
+func TestDagReady(t *testing.T) {
+	var started []string
+	in := &checkingNode{fakeNode{name: "in", started: &started}, errors.New("consumer group not joined")}
+	parser := &fakeNode{name: "parser", started: &started}
+	out := &checkingNode{fakeNode: fakeNode{name: "out", started: &started}}
+
+	c := conf.NewConfig()
+	c.Inputs = []node.Node{in}
+	c.Parsers = []node.Node{parser}
+	c.Outputs = []node.Node{out}
+
+	d, err := dag.NewDag(c)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, d.Init())
+	assert.Equal(t, []dag.Status{{Pipeline: "default", Component: "pipeline", Error: "pipeline is not running"}}, d.Health())
+
+	assert.NoError(t, d.Start())
+	defer d.Stop()
+	assert.Equal(t, []dag.Status{{Pipeline: "default", Component: "pipeline", Healthy: true}}, d.Health())
+	assert.Equal(t, []dag.Status{
+		{Pipeline: "default", Component: "pipeline", Healthy: true},
+		{Pipeline: "default", Component: "in", Error: "consumer group not joined"},
+		{Pipeline: "default", Component: "out", Healthy: true},
+		{Pipeline: "default", Component: "default.inputs", Healthy: true},
+		{Pipeline: "default", Component: "default.out", Healthy: true},
+	}, d.Ready())
+
+	for i := 0; i < dag.DefaultEdgeSize; i++ {
+		out.in.In() <- &edge.Record{}
+	}
+	ready := d.Ready()
+	assert.Equal(t, dag.Status{Pipeline: "default", Component: "default.out", Error: "edge is full"}, ready[len(ready)-1])
+	// let Stop drain the edge
+	for i := 0; i < dag.DefaultEdgeSize; i++ {
+		<-out.in.Out()
+	}
+}
@@ -17,6 +17,8 @@ limitations under the License.
 package node
 
 import (
+	"net/http"
+
 	"github.com/openGemini/openGemini-forwarder/edge"
 )
 
@@ -28,3 +30,57 @@ type Node interface {
 }
 
 type Creator func() Node
+
+// Pauser is implemented by input nodes that can stop emitting records while
+// keeping their source open, so that the records already in the dag can be
+// delivered and acknowledged to the source before Stop.
+type Pauser interface {
+	Pause() error
+}
+
+// Checker is implemented by nodes that can tell whether they are able to do
+// their work, such as an input that joined its source or an output that
+// reaches its server.
+type Checker interface {
+	// Check returns why the node cannot do its work, or nil.
+	Check() error
+}
+
+// Sampler is implemented by plugins that document their settings with an
+// annotated sample of their config table.
+type Sampler interface {
+	SampleConfig() string
+}
+
+// Handler is implemented by inputs that receive http requests and can serve
+// them on the http listener of the forwarder.
+type Handler interface {
+	http.Handler
+	// Pattern returns the path served on the forwarder listener, or "" if
+	// the input listens on an address of its own.
+	Pattern() string
+}
+
+// Aliaser is implemented by nodes that count their records in the node
+// metrics under the alias they have in the config, so that two instances
+// of a plugin are told apart.
+type Aliaser interface {
+	SetAlias(alias string)
+}
+
+// Alias implements Aliaser for the nodes embedding it.
+type Alias struct {
+	alias string
+}
+
+func (a *Alias) SetAlias(alias string) {
+	a.alias = alias
+}
+
+// AliasOr returns the alias of the node, or name if it has none.
+func (a *Alias) AliasOr(name string) string {
+	if a.alias == "" {
+		return name
+	}
+	return a.alias
+}
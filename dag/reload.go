@@ -0,0 +1,164 @@
+/*
+Copyright 2022 Huawei Cloud Computing Technologies Co., Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dag
+
+import (
+	"fmt"
+
+	"github.com/openGemini/openGemini-forwarder/conf"
+	nodeModel "github.com/openGemini/openGemini-forwarder/dag/node"
+)
+
+// Reload applies the pipelines of c to the running dag. Pipelines removed
+// from c are stopped and new ones are started. A pipeline whose inputs,
+// parsers, processors or outputs changed in number or name is drained and rebuilt.
+// Otherwise only its nodes whose config changed are replaced, the new node
+// takes over the edges of the old one, so that the records queued on them
+// are not lost.
+func (d *Dag) Reload(c *conf.Config) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	running := make(map[string]*Pipeline, len(d.pipelines))
+	for _, p := range d.pipelines {
+		running[p.name] = p
+	}
+
+	var errs []error
+	pipelines := make([]*Pipeline, 0, len(d.pipelines))
+	for _, pc := range pipelineConfigs(c) {
+		old, ok := running[pc.Name]
+		delete(running, pc.Name)
+		if ok && old.sameShape(c, pc) {
+			if err := d.replaceNodes(c, old, pc); err != nil {
+				errs = append(errs, err)
+			}
+			pipelines = append(pipelines, old)
+			continue
+		}
+
+		// the edges of the old pipeline are closed before the new ones
+		// open the same disk buffers
+		if ok {
+			if err := old.Stop(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		p, err := newPipeline(c, pc)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("pipeline %s: %v", pc.Name, err))
+			continue
+		}
+		for _, n := range p.inputs {
+			d.setDeadLetter(p, n.n)
+		}
+		d.setDropped(p)
+		if err = p.Init(); err == nil {
+			err = p.Start()
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+		pipelines = append(pipelines, p)
+	}
+	for _, p := range running {
+		if err := p.Stop(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	d.pipelines = pipelines
+
+	if len(errs) > 0 {
+		return fmt.Errorf("reload: %v", errs)
+	}
+	return nil
+}
+
+// sameShape reports whether pc declares the same nodes as p, in the same
+// order, whatever their config.
+func (p *Pipeline) sameShape(c *conf.Config, pc *conf.Pipeline) bool {
+	same := func(nodes []*node, ns []nodeModel.Node) bool {
+		if len(nodes) != len(ns) {
+			return false
+		}
+		for i := range nodes {
+			if nodes[i].name != c.Alias(ns[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return same(p.inputs, pc.Inputs) && same(p.parsers, pc.Parsers) &&
+		same(p.processors, pc.Processors) && same(p.outputs, pc.Outputs)
+}
+
+// replaceNodes replaces the nodes of p whose config differs in pc.
+func (d *Dag) replaceNodes(c *conf.Config, p *Pipeline, pc *conf.Pipeline) error {
+	var errs []error
+	replace := func(nodes []*node, ns []nodeModel.Node) {
+		for i, n := range nodes {
+			if n.digest == c.Digest(ns[i]) {
+				continue
+			}
+			if len(n.parents) == 0 {
+				d.setDeadLetter(p, ns[i])
+			}
+			setRejected(n.name, ns[i], d.pipelineDeadLetter(p))
+			if err := p.replace(n, ns[i], c.Digest(ns[i])); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	replace(p.outputs, pc.Outputs)
+	replace(p.processors, pc.Processors)
+	replace(p.parsers, pc.Parsers)
+	replace(p.inputs, pc.Inputs)
+
+	if len(errs) > 0 {
+		return fmt.Errorf("pipeline %s: %v", p.name, errs)
+	}
+	return nil
+}
+
+// replace stops the node of n and starts nn on its edges. An input is
+// paused first, so that it delivers the records it emitted before it
+// stops. The old node is kept if nn fails to init.
+func (p *Pipeline) replace(n *node, nn nodeModel.Node, digest string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	setAlias(nn, n.name)
+	if err := nn.Init(); err != nil {
+		return fmt.Errorf("init %s: %v", n.name, err)
+	}
+	if p.running {
+		if pauser, ok := n.n.(nodeModel.Pauser); ok && len(n.parents) == 0 {
+			_ = pauser.Pause()
+		}
+		if err := n.n.Stop(); err != nil {
+			return fmt.Errorf("stop %s: %v", n.name, err)
+		}
+	}
+	n.n, n.digest = nn, digest
+	if !p.running {
+		return nil
+	}
+	if err := nn.Start(n.in, n.out); err != nil {
+		return fmt.Errorf("start %s: %v", n.name, err)
+	}
+	return nil
+}
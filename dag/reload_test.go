@@ -0,0 +1,128 @@
+/*
+Copyright 2022 Huawei Cloud Computing Technologies Co., Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dag_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/openGemini/openGemini-forwarder/conf"
+	"github.com/openGemini/openGemini-forwarder/dag"
+	"github.com/openGemini/openGemini-forwarder/dag/node"
+	"github.com/openGemini/openGemini-forwarder/edge"
+	"github.com/openGemini/openGemini-forwarder/plugins/inputs"
+	"github.com/openGemini/openGemini-forwarder/plugins/outputs"
+	"github.com/openGemini/openGemini-forwarder/plugins/parsers"
+	"github.com/stretchr/testify/assert"
+)
+
+// reloadEvents logs the lifecycle of the reloadNodes.
+var reloadEvents []string
+
+type reloadNode struct {
+	node.Alias
+
+	Value string `toml:"value"`
+	name  string
+	in    edge.Edge
+}
+
+func (n *reloadNode) Init() error  { return nil }
+func (n *reloadNode) Name() string { return n.name }
+
+func (n *reloadNode) Start(in edge.Edge, _ edge.Edge) error {
+	n.in = in
+	reloadEvents = append(reloadEvents, "start "+n.name+" "+n.Value)
+	return nil
+}
+
+func (n *reloadNode) Stop() error {
+	reloadEvents = append(reloadEvents, "stop "+n.name+" "+n.Value)
+	return nil
+}
+
+func init() {
+	inputs.Add("reload_in", func() node.Node { return &reloadNode{name: "reload_in"} })
+	parsers.Add("reload_parser", func() node.Node { return &reloadNode{name: "reload_parser"} })
+	outputs.Add("reload_out", func() node.Node { return &reloadNode{name: "reload_out"} })
+}
+
+func reloadConfig(t *testing.T, content string) *conf.Config {
+	path := t.TempDir() + "/forwarder.conf"
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	c := conf.NewConfig()
+	if err := conf.Parse(c, path, ""); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestDagReload(t *testing.T) {
+	reloadEvents = nil
+	c := reloadConfig(t, `
+[[inputs.reload_in]]
+  value = "a"
+[[parsers.reload_parser]]
+[[outputs.reload_out]]
+  value = "a"
+`)
+	d, err := dag.NewDag(c)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, d.Init())
+	assert.NoError(t, d.Start())
+	out := c.Outputs[0].(*reloadNode)
+
+	// only the output changed, the new one reads the same edge
+	c = reloadConfig(t, `
+[[inputs.reload_in]]
+  # comments and the order of the keys do not matter
+  value = "a"
+[[parsers.reload_parser]]
+[[outputs.reload_out]]
+  value = "b"
+`)
+	reloadEvents = nil
+	assert.NoError(t, d.Reload(c))
+	assert.Equal(t, []string{"stop reload_out a", "start reload_out b"}, reloadEvents)
+	assert.Same(t, out.in, c.Outputs[0].(*reloadNode).in)
+
+	// a new output rebuilds the pipeline
+	c = reloadConfig(t, `
+[[inputs.reload_in]]
+  value = "a"
+[[parsers.reload_parser]]
+[[outputs.reload_out]]
+  value = "b"
+[[outputs.reload_out]]
+  alias = "second"
+  value = "c"
+`)
+	reloadEvents = nil
+	assert.NoError(t, d.Reload(c))
+	assert.Equal(t, []string{
+		"stop reload_in a", "stop reload_parser ", "stop reload_out b",
+		"start reload_out c", "start reload_out b", "start reload_parser ", "start reload_in a",
+	}, reloadEvents)
+	assert.Equal(t, 1, len(d.Pipelines()))
+	assert.Equal(t, "reload_out", c.Outputs[0].(*reloadNode).AliasOr("reload_out"))
+	assert.Equal(t, "second", c.Outputs[1].(*reloadNode).AliasOr("reload_out"))
+	assert.NoError(t, d.Stop())
+}
@@ -0,0 +1,162 @@
+/*
+Copyright 2022 Huawei Cloud Computing Technologies Co., Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package edge
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// BroadcastEdge hands every record written to it to each of its branches.
+// The record is retained once per extra branch, so that it is done only
+// after every branch has acked it. A closed edge broadcasts again after
+// Open, so that its pipeline can be restarted.
+type BroadcastEdge struct {
+	name     string
+	edge     chan *Record
+	branches []Edge
+	// pending is 1 while a record is being handed to the branches.
+	pending int32
+
+	mu sync.Mutex
+	// closing is nil while the edge is closed
+	closing chan struct{}
+	wg      sync.WaitGroup
+}
+
+func NewBroadcastEdge(name string, size int, n int) *BroadcastEdge {
+	branches := make([]Edge, 0, n)
+	for i := 0; i < n; i++ {
+		branches = append(branches, NewEdge(name, size))
+	}
+	return NewBroadcastEdgeTo(name, size, branches)
+}
+
+// NewBroadcastEdgeTo returns an edge that broadcasts to the given branches.
+func NewBroadcastEdgeTo(name string, size int, branches []Edge) *BroadcastEdge {
+	e := &BroadcastEdge{
+		name:     name,
+		edge:     make(chan *Record, size),
+		branches: branches,
+	}
+
+	_ = e.Open()
+	return e
+}
+
+// Out returns the channel the records are broadcast from, children read
+// from their Branch instead.
+func (e *BroadcastEdge) Out() chan *Record {
+	return e.edge
+}
+
+func (e *BroadcastEdge) In() chan *Record {
+	return e.edge
+}
+
+func (e *BroadcastEdge) Name() string {
+	return e.name
+}
+
+// Branch returns the edge the i-th child reads from.
+func (e *BroadcastEdge) Branch(i int) Edge {
+	return e.branches[i]
+}
+
+// Len returns the number of records queued before and in the branches.
+func (e *BroadcastEdge) Len() int {
+	n := len(e.edge) + int(atomic.LoadInt32(&e.pending))
+	for _, b := range e.branches {
+		n += b.Len()
+	}
+	return n
+}
+
+// Open starts broadcasting, it does nothing if the edge is open.
+func (e *BroadcastEdge) Open() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closing != nil {
+		return nil
+	}
+	e.closing = make(chan struct{})
+	e.wg.Add(1)
+	go e.run(e.closing)
+	return nil
+}
+
+// Close stops broadcasting, records not yet handed to every branch are
+// never done.
+func (e *BroadcastEdge) Close() error {
+	e.mu.Lock()
+	if e.closing != nil {
+		close(e.closing)
+		e.closing = nil
+	}
+	e.mu.Unlock()
+	e.wg.Wait()
+	return nil
+}
+
+// Flush waits until the records written before it have been handed to
+// every branch, so that they are counted by the branches. The writers must
+// be stopped. It returns false if the deadline expires first.
+func (e *BroadcastEdge) Flush(deadline time.Time) bool {
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+
+	marker := &Record{flushed: make(chan struct{})}
+	select {
+	case e.edge <- marker:
+	case <-timer.C:
+		return false
+	}
+	select {
+	case <-marker.flushed:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+func (e *BroadcastEdge) run(closing chan struct{}) {
+	defer e.wg.Done()
+	for {
+		select {
+		case <-closing:
+			return
+		case record := <-e.edge:
+			if record.flushed != nil {
+				close(record.flushed)
+				continue
+			}
+			atomic.StoreInt32(&e.pending, 1)
+			if len(e.branches) > 1 {
+				record.Retain(len(e.branches) - 1)
+			}
+			for _, b := range e.branches {
+				select {
+				case b.In() <- record:
+				case <-closing:
+					return
+				}
+			}
+			atomic.StoreInt32(&e.pending, 0)
+		}
+	}
+}
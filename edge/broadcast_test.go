@@ -0,0 +1,52 @@
+/*
+Copyright 2022 Huawei Cloud Computing Technologies Co., Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package edge_test
+
+import (
+	"testing"
+
+	"github.com/openGemini/openGemini-forwarder/edge"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBroadcastEdge(t *testing.T) {
+	e := edge.NewBroadcastEdge("test", 1, 3)
+	defer e.Close()
+
+	done := 0
+	rec := &edge.Record{Done: func(*edge.Record, error) { done++ }}
+	e.In() <- rec
+	for i := 0; i < 3; i++ {
+		r := <-e.Branch(i).Out()
+		assert.Same(t, rec, r)
+		assert.Equal(t, 0, done)
+		rec.Ack()
+	}
+	assert.Equal(t, 1, done)
+}
+
+func TestBroadcastEdgeReopen(t *testing.T) {
+	e := edge.NewBroadcastEdge("test", 1, 2)
+	assert.NoError(t, e.Close())
+	assert.NoError(t, e.Open())
+	defer e.Close()
+
+	rec := &edge.Record{}
+	e.In() <- rec
+	assert.Same(t, rec, <-e.Branch(0).Out())
+	assert.Same(t, rec, <-e.Branch(1).Out())
+}
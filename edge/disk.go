@@ -0,0 +1,711 @@
+/*
+Copyright 2022 Huawei Cloud Computing Technologies Co., Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package edge
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/influxdata/influxdb/models"
+)
+
+const (
+	diskSegmentExt = ".seg"
+	diskCursorFile = "cursor"
+	// diskHeaderSize is the size of the length prefixing every entry.
+	diskHeaderSize = 4
+	// diskBatchSize is the most records written to disk per sync.
+	diskBatchSize = 100
+	// the cursor is saved once diskCursorEntries entries are done or
+	// diskCursorInterval has passed, and when the edge is closed
+	diskCursorEntries  = 1000
+	diskCursorInterval = time.Second
+)
+
+var (
+	// DiskRetryInterval is how long a record nacked by the children waits
+	// before it is handed to them again.
+	DiskRetryInterval = time.Second
+
+	// DiskMaxInflight is how many records read back from disk are handed to
+	// the children and not done at once, the reading waits beyond it.
+	DiskMaxInflight = 1000
+)
+
+var errDiskClosed = errors.New("edge closed")
+
+// DiskEdge writes the records to segment files in a directory before
+// handing them to its children, so that they survive an outage of the
+// children and a restart of the process. A record is acked as soon as it
+// is durable, the copy read back from disk is handed to the children, in
+// the order the records were written, and is delivered again until it is
+// acked or nacked with a permanent error. Writers are blocked while the
+// segments reach the max size. The records written together are synced
+// once, the position of the records done is saved from time to time, so a
+// few of them may be delivered again after a crash.
+type DiskEdge struct {
+	name        string
+	dir         string
+	maxSize     int64
+	segmentSize int64
+
+	in  chan *Record
+	out chan *Record
+	// writing is the number of records being written to disk.
+	writing int32
+
+	mu sync.Mutex
+	// state is nil while the edge is closed
+	state   *diskState
+	dropped func(r *Record, err error)
+	wg      sync.WaitGroup
+}
+
+func NewDiskEdge(name string, size int, dir string, maxSize int64, segmentSize int64) (*DiskEdge, error) {
+	e := &DiskEdge{
+		name:        name,
+		dir:         dir,
+		maxSize:     maxSize,
+		segmentSize: segmentSize,
+		in:          make(chan *Record, size),
+		out:         make(chan *Record, size),
+	}
+	if err := e.Open(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (e *DiskEdge) In() chan *Record {
+	return e.in
+}
+
+func (e *DiskEdge) Out() chan *Record {
+	return e.out
+}
+
+func (e *DiskEdge) Name() string {
+	return e.name
+}
+
+// Len returns the number of records that are not durable yet.
+func (e *DiskEdge) Len() int {
+	return len(e.in) + int(atomic.LoadInt32(&e.writing))
+}
+
+// SetDropped sets fn to be called with the records the children failed
+// for good, before they are removed from the disk.
+func (e *DiskEdge) SetDropped(fn func(r *Record, err error)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.dropped = fn
+}
+
+func (e *DiskEdge) droppedFunc() func(r *Record, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.dropped
+}
+
+// Open loads the segments left in the directory and starts writing and
+// replaying them, it does nothing if the edge is open.
+func (e *DiskEdge) Open() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.state != nil {
+		return nil
+	}
+
+	s, err := openDiskState(e)
+	if err != nil {
+		return fmt.Errorf("open %s: %v", e.name, err)
+	}
+	e.state = s
+	e.wg.Add(2)
+	go s.writeLoop()
+	go s.readLoop()
+	return nil
+}
+
+// Close stops writing and replaying. The records handed to the children
+// and not done yet are replayed after the next Open.
+func (e *DiskEdge) Close() error {
+	e.mu.Lock()
+	s := e.state
+	e.state = nil
+	e.mu.Unlock()
+	if s == nil {
+		return nil
+	}
+
+	close(s.closing)
+	e.wg.Wait()
+	return s.close()
+}
+
+// diskPos locates an entry in the segments.
+type diskPos struct {
+	seg uint64
+	off int64
+}
+
+// diskEntry is an entry handed to the children.
+type diskEntry struct {
+	next diskPos
+	done bool
+}
+
+// diskRecord is the encoding of a record in the segments.
+type diskRecord struct {
+	Source  Source `json:"source"`
+	Payload []byte `json:"payload"`
+	// Points is the line protocol of the points, parsed again when the
+	// record is read back, so that their field types are kept.
+	Points []byte `json:"points,omitempty"`
+}
+
+// diskState is the state of an open DiskEdge.
+type diskState struct {
+	e       *DiskEdge
+	closing chan struct{}
+	// written and committed wake up the read loop, freed the write loop
+	written   chan struct{}
+	committed chan struct{}
+	freed     chan struct{}
+
+	mu       sync.Mutex
+	closed   bool
+	segments []uint64
+	sizes    map[uint64]int64
+	size     int64
+	wfile    *os.File
+	// wpos is the end of the last entry written
+	wpos diskPos
+	// commit is the end of the last entry done, the entries before it are
+	// not replayed again
+	commit   diskPos
+	inflight []*diskEntry
+	// unsaved is the number of entries done since the cursor was saved
+	unsaved int
+	savedAt time.Time
+}
+
+func openDiskState(e *DiskEdge) (*diskState, error) {
+	if err := os.MkdirAll(e.dir, 0750); err != nil {
+		return nil, err
+	}
+	names, err := filepath.Glob(filepath.Join(e.dir, "*"+diskSegmentExt))
+	if err != nil {
+		return nil, err
+	}
+
+	s := &diskState{
+		e:         e,
+		closing:   make(chan struct{}),
+		written:   make(chan struct{}, 1),
+		committed: make(chan struct{}, 1),
+		freed:     make(chan struct{}, 1),
+		sizes:     make(map[uint64]int64),
+		savedAt:   time.Now(),
+	}
+	for _, name := range names {
+		id, err := strconv.ParseUint(strings.TrimSuffix(filepath.Base(name), diskSegmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := os.Stat(name)
+		if err != nil {
+			return nil, err
+		}
+		s.segments = append(s.segments, id)
+		s.sizes[id] = info.Size()
+		s.size += info.Size()
+	}
+	sort.Slice(s.segments, func(i, j int) bool { return s.segments[i] < s.segments[j] })
+	if n := len(s.segments); n > 0 {
+		last := s.segments[n-1]
+		size, err := truncateTorn(s.segmentPath(last), s.sizes[last])
+		if err != nil {
+			return nil, err
+		}
+		s.size -= s.sizes[last] - size
+		s.sizes[last] = size
+		s.wpos = diskPos{seg: last, off: size}
+		s.commit = diskPos{seg: s.segments[0]}
+	}
+
+	data, err := os.ReadFile(filepath.Join(e.dir, diskCursorFile))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	var cursor diskPos
+	if _, serr := fmt.Sscanf(string(data), "%d %d", &cursor.seg, &cursor.off); serr == nil && cursor.seg >= s.commit.seg {
+		// the cursor may be past the entries cut by truncateTorn
+		if size, ok := s.sizes[cursor.seg]; ok && cursor.off <= size {
+			s.commit = cursor
+		}
+	}
+	return s, nil
+}
+
+// truncateTorn cuts the entry a crash left short at the end of the segment
+// and returns the size of the whole entries.
+func truncateTorn(name string, size int64) (int64, error) {
+	f, err := os.OpenFile(name, os.O_RDWR, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var off int64
+	var header [diskHeaderSize]byte
+	for off+diskHeaderSize <= size {
+		if _, err = f.ReadAt(header[:], off); err != nil {
+			return 0, err
+		}
+		n := diskHeaderSize + int64(binary.BigEndian.Uint32(header[:]))
+		if off+n > size {
+			break
+		}
+		off += n
+	}
+	if off == size {
+		return size, nil
+	}
+	if err = f.Truncate(off); err != nil {
+		return 0, err
+	}
+	return off, f.Sync()
+}
+
+func (s *diskState) segmentPath(id uint64) string {
+	return filepath.Join(s.e.dir, fmt.Sprintf("%020d%s", id, diskSegmentExt))
+}
+
+func (s *diskState) writeLoop() {
+	defer s.e.wg.Done()
+	for {
+		select {
+		case <-s.closing:
+			return
+		case record := <-s.e.in:
+			s.writeBatch(s.collect(record))
+		}
+	}
+}
+
+// collect returns record and the records already queued behind it, without
+// waiting for more.
+func (s *diskState) collect(record *Record) []*Record {
+	batch := []*Record{record}
+	for len(batch) < diskBatchSize {
+		select {
+		case r := <-s.e.in:
+			batch = append(batch, r)
+		default:
+			return batch
+		}
+	}
+	return batch
+}
+
+// writeBatch writes the records and acks them once they are synced.
+func (s *diskState) writeBatch(batch []*Record) {
+	atomic.StoreInt32(&s.e.writing, int32(len(batch)))
+	defer atomic.StoreInt32(&s.e.writing, 0)
+
+	written := make([]*Record, 0, len(batch))
+	// flush is also called before waiting for room, so that the records
+	// written so far are not held meanwhile
+	flush := func() {
+		if len(written) == 0 {
+			return
+		}
+		err := s.sync()
+		for _, record := range written {
+			if err != nil {
+				record.Nack(WithStage(s.e.name, err))
+			} else {
+				record.Ack()
+			}
+		}
+		atomic.AddInt32(&s.e.writing, -int32(len(written)))
+		written = written[:0]
+	}
+	for _, record := range batch {
+		if err := s.write(record, flush); err != nil {
+			record.Nack(WithStage(s.e.name, err))
+			atomic.AddInt32(&s.e.writing, -1)
+			continue
+		}
+		written = append(written, record)
+	}
+	flush()
+}
+
+// write appends the record to the last segment once there is room for it,
+// it calls wait before waiting for room.
+func (s *diskState) write(record *Record, wait func()) error {
+	dr := diskRecord{Source: record.Source, Payload: record.Payload}
+	if len(record.Points) > 0 {
+		points, err := record.LineProtocol()
+		if err != nil {
+			return Permanent(fmt.Errorf("encode record: %v", err))
+		}
+		dr.Points = points
+	}
+	buf, err := json.Marshal(dr)
+	if err != nil {
+		return Permanent(fmt.Errorf("encode record: %v", err))
+	}
+	entry := make([]byte, diskHeaderSize, diskHeaderSize+len(buf))
+	binary.BigEndian.PutUint32(entry, uint32(len(buf)))
+	entry = append(entry, buf...)
+
+	for {
+		s.mu.Lock()
+		if s.size == 0 || s.size+int64(len(entry)) <= s.e.maxSize {
+			break
+		}
+		// let the segment being written be removed once it is done
+		if s.wfile != nil && s.sizes[s.wpos.seg] > 0 {
+			if err = s.rotate(); err != nil {
+				s.mu.Unlock()
+				return err
+			}
+		}
+		s.mu.Unlock()
+		wait()
+		select {
+		case <-s.freed:
+		case <-s.closing:
+			return errDiskClosed
+		}
+	}
+	if s.wfile == nil || s.sizes[s.wpos.seg] >= s.e.segmentSize {
+		if err = s.rotate(); err != nil {
+			s.mu.Unlock()
+			return err
+		}
+	}
+	f, pos := s.wfile, s.wpos
+	s.mu.Unlock()
+
+	// only the write loop writes, the segment cannot be removed while it
+	// is past the commit position
+	if _, err = f.WriteAt(entry, pos.off); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	n := int64(len(entry))
+	s.wpos.off += n
+	s.sizes[pos.seg] += n
+	s.size += n
+	s.mu.Unlock()
+	notify(s.written)
+	return nil
+}
+
+// sync flushes the segment being written to disk.
+func (s *diskState) sync() error {
+	s.mu.Lock()
+	f := s.wfile
+	s.mu.Unlock()
+	if f == nil {
+		return nil
+	}
+	return f.Sync()
+}
+
+// rotate starts a new segment, s.mu is held.
+func (s *diskState) rotate() error {
+	var id uint64 = 1
+	if n := len(s.segments); n > 0 {
+		id = s.segments[n-1] + 1
+	}
+	f, err := os.OpenFile(s.segmentPath(id), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0640)
+	if err != nil {
+		return err
+	}
+	if s.wfile != nil {
+		// the entries of the segment not synced yet are synced with it
+		if err = s.wfile.Sync(); err != nil {
+			_ = f.Close()
+			_ = os.Remove(f.Name())
+			return err
+		}
+		_ = s.wfile.Close()
+	}
+	s.wfile = f
+	s.segments = append(s.segments, id)
+	s.sizes[id] = 0
+	s.wpos = diskPos{seg: id}
+	return nil
+}
+
+func (s *diskState) readLoop() {
+	defer s.e.wg.Done()
+	var rfile *os.File
+	defer func() {
+		if rfile != nil {
+			_ = rfile.Close()
+		}
+	}()
+
+	s.mu.Lock()
+	rpos := s.commit
+	s.mu.Unlock()
+	for {
+		s.mu.Lock()
+		end := s.wpos
+		limit := s.sizes[rpos.seg]
+		next := s.nextSegment(rpos.seg)
+		full := len(s.inflight) >= DiskMaxInflight
+		s.mu.Unlock()
+
+		if full || rpos == end || (rpos.off >= limit && next == 0) {
+			select {
+			case <-s.closing:
+				return
+			case <-s.written:
+				continue
+			case <-s.committed:
+				continue
+			}
+		}
+		if rpos.off >= limit {
+			rpos = diskPos{seg: next}
+			continue
+		}
+
+		if rfile == nil || rfile.Name() != s.segmentPath(rpos.seg) {
+			if rfile != nil {
+				_ = rfile.Close()
+			}
+			var err error
+			if rfile, err = os.Open(s.segmentPath(rpos.seg)); err != nil {
+				rfile = nil
+				rpos = skipSegment(next, end)
+				continue
+			}
+		}
+		record, n, err := readEntry(rfile, rpos.off, limit)
+		if err != nil {
+			rpos = skipSegment(next, end)
+			continue
+		}
+		rpos.off += n
+
+		entry := &diskEntry{next: rpos}
+		s.mu.Lock()
+		s.inflight = append(s.inflight, entry)
+		s.mu.Unlock()
+		if record == nil {
+			s.done(entry)
+			continue
+		}
+		record.Done = func(r *Record, err error) {
+			s.onDone(r, entry, err)
+		}
+		select {
+		case s.e.out <- record:
+		case <-s.closing:
+			return
+		}
+	}
+}
+
+// skipSegment returns where to read after an entry that cannot be read:
+// the next segment, or the end written if the entry is in the last one.
+func skipSegment(next uint64, end diskPos) diskPos {
+	if next == 0 {
+		return end
+	}
+	return diskPos{seg: next}
+}
+
+// nextSegment returns the first segment after id, or 0, s.mu is held.
+func (s *diskState) nextSegment(id uint64) uint64 {
+	for _, seg := range s.segments {
+		if seg > id {
+			return seg
+		}
+	}
+	return 0
+}
+
+// readEntry reads the entry at off, it returns a nil record if the entry
+// does not decode.
+func readEntry(f *os.File, off int64, limit int64) (*Record, int64, error) {
+	var header [diskHeaderSize]byte
+	if _, err := f.ReadAt(header[:], off); err != nil {
+		return nil, 0, err
+	}
+	n := int64(binary.BigEndian.Uint32(header[:]))
+	if off+diskHeaderSize+n > limit {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+	buf := make([]byte, n)
+	if _, err := f.ReadAt(buf, off+diskHeaderSize); err != nil {
+		return nil, 0, err
+	}
+
+	var dr diskRecord
+	if err := json.Unmarshal(buf, &dr); err != nil {
+		return nil, diskHeaderSize + n, nil
+	}
+	record := &Record{Payload: dr.Payload, Source: dr.Source, Attempts: 1}
+	if len(dr.Points) > 0 {
+		points, err := parsePoints(dr.Points)
+		if err != nil {
+			return nil, diskHeaderSize + n, nil
+		}
+		record.Points = points
+	}
+	return record, diskHeaderSize + n, nil
+}
+
+// parsePoints parses the line protocol written by Record.LineProtocol.
+func parsePoints(buf []byte) ([]Point, error) {
+	pts, err := models.ParsePointsWithPrecision(buf, time.Time{}, "n")
+	if err != nil {
+		return nil, err
+	}
+	points := make([]Point, 0, len(pts))
+	for _, pt := range pts {
+		fields, err := pt.Fields()
+		if err != nil {
+			return nil, err
+		}
+		points = append(points, Point{
+			Measurement: string(pt.Name()),
+			Tags:        pt.Tags().Map(),
+			Fields:      fields,
+			Time:        pt.Time(),
+		})
+	}
+	return points, nil
+}
+
+// onDone hands the record to the children again after a delay unless it
+// is delivered or failed for good, the records failed for good are handed
+// to the dropped func of the edge.
+func (s *diskState) onDone(record *Record, entry *diskEntry, err error) {
+	if err != nil && IsPermanent(err) {
+		if dropped := s.e.droppedFunc(); dropped != nil {
+			dropped(record, err)
+		}
+	}
+	if err == nil || IsPermanent(err) {
+		s.done(entry)
+		return
+	}
+
+	time.AfterFunc(DiskRetryInterval, func() {
+		record.Attempts++
+		select {
+		case s.e.out <- record:
+		case <-s.closing:
+		}
+	})
+}
+
+// done moves the commit position past the entries done in order, and
+// removes the segments left behind.
+func (s *diskState) done(entry *diskEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+
+	entry.done = true
+	n := 0
+	for n < len(s.inflight) && s.inflight[n].done {
+		s.commit = s.inflight[n].next
+		n++
+	}
+	if n == 0 {
+		return
+	}
+	s.inflight = s.inflight[n:]
+	if next := s.nextSegment(s.commit.seg); next != 0 && s.commit.off >= s.sizes[s.commit.seg] {
+		s.commit = diskPos{seg: next}
+	}
+	notify(s.committed)
+	if s.unsaved += n; s.unsaved >= diskCursorEntries || time.Since(s.savedAt) >= diskCursorInterval {
+		_ = s.saveCursor()
+	}
+
+	freed := false
+	for len(s.segments) > 1 && s.segments[0] < s.commit.seg {
+		id := s.segments[0]
+		_ = os.Remove(s.segmentPath(id))
+		s.size -= s.sizes[id]
+		delete(s.sizes, id)
+		s.segments = s.segments[1:]
+		freed = true
+	}
+	if freed {
+		notify(s.freed)
+	}
+}
+
+// saveCursor persists the commit position, s.mu is held.
+func (s *diskState) saveCursor() error {
+	name := filepath.Join(s.e.dir, diskCursorFile)
+	data := fmt.Sprintf("%d %d", s.commit.seg, s.commit.off)
+	if err := os.WriteFile(name+".tmp", []byte(data), 0640); err != nil {
+		return err
+	}
+	s.unsaved = 0
+	s.savedAt = time.Now()
+	return os.Rename(name+".tmp", name)
+}
+
+func (s *diskState) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	err := s.saveCursor()
+	if s.wfile != nil {
+		if cerr := s.wfile.Close(); err == nil {
+			err = cerr
+		}
+		s.wfile = nil
+	}
+	return err
+}
+
+func notify(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
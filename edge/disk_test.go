@@ -0,0 +1,225 @@
+/*
+Copyright 2022 Huawei Cloud Computing Technologies Co., Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package edge_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/openGemini/openGemini-forwarder/edge"
+	"github.com/stretchr/testify/assert"
+)
+
+func receive(t *testing.T, e edge.Edge) *edge.Record {
+	select {
+	case r := <-e.Out():
+		return r
+	case <-time.After(5 * time.Second):
+		t.Fatal("no record received")
+		return nil
+	}
+}
+
+func TestDiskEdge(t *testing.T) {
+	defer func(d time.Duration) { edge.DiskRetryInterval = d }(edge.DiskRetryInterval)
+	edge.DiskRetryInterval = time.Millisecond
+
+	dir := t.TempDir()
+	e, err := edge.NewDiskEdge("test", 1, dir, 1024, 64)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	acked := make(chan error, 3)
+	for _, payload := range []string{"m1 v=1", "m2 v=2", "m3 v=3"} {
+		e.In() <- &edge.Record{
+			Payload: []byte(payload),
+			Source:  edge.Source{Topic: "t", Offset: 1},
+			Done:    func(_ *edge.Record, err error) { acked <- err },
+		}
+	}
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, <-acked)
+	}
+
+	r := receive(t, e)
+	assert.Equal(t, "m1 v=1", string(r.Payload))
+	assert.Equal(t, "t", r.Source.Topic)
+	r.Ack()
+	r = receive(t, e)
+	assert.Equal(t, "m2 v=2", string(r.Payload))
+	r.Nack(errors.New("write fail"))
+	r = receive(t, e)
+	assert.Equal(t, "m3 v=3", string(r.Payload))
+	r = receive(t, e)
+	assert.Equal(t, "m2 v=2", string(r.Payload))
+	assert.Equal(t, 2, r.Attempts)
+	assert.NoError(t, e.Close())
+
+	// the records not done are replayed after a restart
+	e, err = edge.NewDiskEdge("test", 1, dir, 1024, 64)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer e.Close()
+	r = receive(t, e)
+	assert.Equal(t, "m2 v=2", string(r.Payload))
+	r.Ack()
+	r = receive(t, e)
+	assert.Equal(t, "m3 v=3", string(r.Payload))
+	r.Ack()
+}
+
+func TestDiskEdgeMaxSize(t *testing.T) {
+	e, err := edge.NewDiskEdge("test", 1, t.TempDir(), 100, 10)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer e.Close()
+
+	acked := make(chan struct{}, 10)
+	// one record is written, one waits for room and one is queued
+	for i := 0; i < 3; i++ {
+		e.In() <- &edge.Record{
+			Payload: []byte("cpu value=1"),
+			Done:    func(*edge.Record, error) { acked <- struct{}{} },
+		}
+	}
+	<-acked
+	select {
+	case <-acked:
+		t.Fatal("record written past the max size")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	receive(t, e).Ack()
+	select {
+	case <-acked:
+	case <-time.After(5 * time.Second):
+		t.Fatal("record not written once room was made")
+	}
+}
+
+// write writes the records to e and waits until they are durable.
+func write(t *testing.T, e edge.Edge, records ...*edge.Record) {
+	acked := make(chan error, len(records))
+	for _, r := range records {
+		r.Done = func(_ *edge.Record, err error) { acked <- err }
+		e.In() <- r
+	}
+	for range records {
+		assert.NoError(t, <-acked)
+	}
+}
+
+func noRecord(t *testing.T, e edge.Edge) {
+	select {
+	case r := <-e.Out():
+		t.Fatalf("unexpected record %q", r.Payload)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestDiskEdgeTornEntry(t *testing.T) {
+	dir := t.TempDir()
+	e, err := edge.NewDiskEdge("test", 1, dir, 1024, 1024)
+	if !assert.NoError(t, err) {
+		return
+	}
+	write(t, e, &edge.Record{Payload: []byte("m1 v=1")}, &edge.Record{Payload: []byte("m2 v=2")})
+	assert.NoError(t, e.Close())
+
+	// a crash cuts the last entry short
+	segments, _ := filepath.Glob(filepath.Join(dir, "*.seg"))
+	if !assert.Len(t, segments, 1) {
+		return
+	}
+	info, _ := os.Stat(segments[0])
+	f, err := os.OpenFile(segments[0], os.O_APPEND|os.O_WRONLY, 0)
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = f.Write([]byte{0, 0, 0, 100, '{'})
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+
+	e, err = edge.NewDiskEdge("test", 1, dir, 1024, 1024)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer e.Close()
+	truncated, _ := os.Stat(segments[0])
+	assert.Equal(t, info.Size(), truncated.Size())
+
+	assert.Equal(t, "m1 v=1", string(receive(t, e).Payload))
+	r := receive(t, e)
+	assert.Equal(t, "m2 v=2", string(r.Payload))
+	r.Ack()
+	noRecord(t, e)
+
+	write(t, e, &edge.Record{Payload: []byte("m3 v=3")})
+	assert.Equal(t, "m3 v=3", string(receive(t, e).Payload))
+	noRecord(t, e)
+}
+
+func TestDiskEdgePoints(t *testing.T) {
+	e, err := edge.NewDiskEdge("test", 1, t.TempDir(), 1024, 1024)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer e.Close()
+
+	points := []edge.Point{{
+		Measurement: "cpu",
+		Tags:        map[string]string{"host": "a"},
+		Fields:      map[string]interface{}{"n": int64(1), "v": 1.5, "s": "x", "ok": true},
+		Time:        time.Unix(0, 42),
+	}}
+	write(t, e, &edge.Record{Payload: []byte(`{"n": 1}`), Points: points})
+	r := receive(t, e)
+	assert.Equal(t, `{"n": 1}`, string(r.Payload))
+	assert.Equal(t, points[0].Measurement, r.Points[0].Measurement)
+	assert.Equal(t, points[0].Tags, r.Points[0].Tags)
+	assert.Equal(t, points[0].Fields, r.Points[0].Fields)
+	assert.True(t, points[0].Time.Equal(r.Points[0].Time))
+	r.Ack()
+}
+
+func TestDiskEdgeMaxInflight(t *testing.T) {
+	defer func(n int) { edge.DiskMaxInflight = n }(edge.DiskMaxInflight)
+	edge.DiskMaxInflight = 1
+
+	e, err := edge.NewDiskEdge("test", 2, t.TempDir(), 1024, 1024)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer e.Close()
+	var dropped []string
+	e.SetDropped(func(r *edge.Record, err error) {
+		dropped = append(dropped, string(r.Payload))
+	})
+
+	write(t, e, &edge.Record{Payload: []byte("m1 v=1")}, &edge.Record{Payload: []byte("m2 v=2")})
+	r := receive(t, e)
+	noRecord(t, e)
+	r.Nack(edge.Permanent(errors.New("bad line")))
+	receive(t, e).Ack()
+	assert.Equal(t, []string{"m1 v=1"}, dropped)
+}
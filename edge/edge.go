@@ -17,24 +17,35 @@ limitations under the License.
 package edge
 
 type Edge interface {
-	Out() chan Record
-	In() chan Record
+	Out() chan *Record
+	In() chan *Record
+	// Len returns the number of records queued on the edge.
+	Len() int
+	Name() string
 }
 
 func NewEdge(name string, size int) *StatEdge {
-	edge := make(chan Record, size)
+	edge := make(chan *Record, size)
 	return &StatEdge{name: name, edge: edge}
 }
 
 type StatEdge struct {
 	name string
-	edge chan Record
+	edge chan *Record
 }
 
-func (e *StatEdge) Out() chan Record {
+func (e *StatEdge) Out() chan *Record {
 	return e.edge
 }
 
-func (e *StatEdge) In() chan Record {
+func (e *StatEdge) In() chan *Record {
 	return e.edge
 }
+
+func (e *StatEdge) Name() string {
+	return e.name
+}
+
+func (e *StatEdge) Len() int {
+	return len(e.edge)
+}
@@ -16,14 +16,182 @@ limitations under the License.
 
 package edge
 
-import "github.com/Shopify/sarama"
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
 
-type Record interface {
+	"github.com/influxdata/influxdb/models"
+)
+
+// Record is the unit of data flowing through the dag. Inputs fill Payload
+// and Source, parsers fill Points, and outputs write Points, or Payload as
+// line protocol when the record carries no points.
+type Record struct {
+	Payload []byte
+	Points  []Point
+	Source  Source
+
+	// Done is called once every holder has acked or nacked the record, err
+	// is the first error the record was nacked with.
+	Done func(r *Record, err error)
+	// Attempts is the number of times the record was delivered to the dag.
+	Attempts int
+
+	// refs is the number of extra holders, the record is done when the
+	// last holder releases it.
+	refs int32
+	mu   sync.Mutex
+	err  error
+
+	// flushed is set on the markers written by BroadcastEdge.Flush.
+	flushed chan struct{}
+}
+
+type Records []*Record
+
+// Source locates the message a record was read from.
+type Source struct {
+	Topic     string
+	Partition int32
+	Offset    int64
+	Headers   map[string]string
+	// Timestamp is the time the source assigned to the message.
+	Timestamp time.Time
+	// Tags are added by the parsers to the points of the record.
+	Tags map[string]string
+}
+
+// Point is a parsed data point.
+type Point struct {
+	Measurement string
+	Tags        map[string]string
+	Fields      map[string]interface{}
+	// Time is left zero to let the database assign it.
+	Time time.Time
+}
+
+// AppendLineProtocol appends the line protocol encoding of p to dst.
+func (p *Point) AppendLineProtocol(dst []byte) ([]byte, error) {
+	pt, err := models.NewPoint(p.Measurement, models.NewTags(p.Tags), p.Fields, p.Time)
+	if err != nil {
+		return dst, err
+	}
+	return pt.AppendString(dst), nil
+}
+
+// Retain adds n holders, each of them acks or nacks the record once.
+func (r *Record) Retain(n int) {
+	atomic.AddInt32(&r.refs, int32(n))
+}
+
+// Ack reports that the holder has delivered the record.
+func (r *Record) Ack() {
+	r.release(nil)
+}
+
+// Nack reports that the holder failed to deliver the record.
+func (r *Record) Nack(err error) {
+	r.release(err)
+}
+
+func (r *Record) release(err error) {
+	r.mu.Lock()
+	if r.err == nil {
+		r.err = err
+	}
+	r.mu.Unlock()
+	if atomic.AddInt32(&r.refs, -1) >= 0 {
+		return
+	}
+
+	r.mu.Lock()
+	err = r.err
+	r.err = nil
+	r.mu.Unlock()
+	// the record may be delivered again from Done
+	atomic.StoreInt32(&r.refs, 0)
+	if r.Done != nil {
+		r.Done(r, err)
+	}
 }
 
-type Records []Record
+// LineProtocol returns the line protocol encoding of the record.
+func (r *Record) LineProtocol() ([]byte, error) {
+	if len(r.Points) == 0 {
+		return r.Payload, nil
+	}
+
+	var buf []byte
+	var err error
+	for i := range r.Points {
+		if i > 0 {
+			buf = append(buf, '\n')
+		}
+		if buf, err = r.Points[i].AppendLineProtocol(buf); err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+// Reset clears the record so that it can be reused.
+func (r *Record) Reset() {
+	r.Payload = nil
+	r.Points = nil
+	r.Source = Source{}
+	r.Done = nil
+	r.Attempts = 0
+	r.err = nil
+	atomic.StoreInt32(&r.refs, 0)
+}
+
+// permanentError wraps a nack error that delivering the record again cannot
+// fix, such as a message that does not parse.
+type permanentError struct {
+	error
+}
+
+func (e permanentError) Unwrap() error {
+	return e.error
+}
+
+// ErrStopped fails the records a node could not write to its output edge
+// before it stopped, the inputs deliver them again.
+var ErrStopped = errors.New("node stopped")
+
+// Permanent marks err as permanent, inputs drop the record instead of
+// delivering it again.
+func Permanent(err error) error {
+	return permanentError{err}
+}
+
+func IsPermanent(err error) bool {
+	return errors.As(err, &permanentError{})
+}
+
+// stageError names the node a nack error comes from.
+type stageError struct {
+	stage string
+	error
+}
+
+func (e stageError) Unwrap() error {
+	return e.error
+}
+
+// WithStage tags err with the name of the node that failed to deliver the
+// record.
+func WithStage(stage string, err error) error {
+	return stageError{stage: stage, error: err}
+}
 
-type KafkaRecord struct {
-	Message *sarama.ConsumerMessage
-	Session sarama.ConsumerGroupSession
+// Stage returns the name err was tagged with by WithStage, or "".
+func Stage(err error) string {
+	var se stageError
+	if errors.As(err, &se) {
+		return se.stage
+	}
+	return ""
 }
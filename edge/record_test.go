@@ -0,0 +1,75 @@
+/*
+Copyright 2022 Huawei Cloud Computing Technologies Co., Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package edge_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/openGemini/openGemini-forwarder/edge"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordDone(t *testing.T) {
+	var done []error
+	rec := &edge.Record{Done: func(_ *edge.Record, err error) {
+		done = append(done, err)
+	}}
+
+	rec.Retain(2)
+	rec.Ack()
+	rec.Nack(errors.New("write failed"))
+	assert.Empty(t, done)
+	rec.Ack()
+	assert.EqualError(t, done[0], "write failed")
+
+	rec.Ack()
+	assert.Equal(t, 2, len(done))
+	assert.NoError(t, done[1])
+}
+
+func TestRecordLineProtocol(t *testing.T) {
+	rec := &edge.Record{Payload: []byte("cpu value=1")}
+	lp, err := rec.LineProtocol()
+	assert.NoError(t, err)
+	assert.Equal(t, "cpu value=1", string(lp))
+
+	rec.Points = []edge.Point{
+		{
+			Measurement: "cpu",
+			Tags:        map[string]string{"host": "a", "dc": "b"},
+			Fields:      map[string]interface{}{"value": 1.5},
+			Time:        time.Unix(0, 100),
+		},
+		{
+			Measurement: "mem",
+			Fields:      map[string]interface{}{"used": int64(3)},
+		},
+	}
+	lp, err = rec.LineProtocol()
+	assert.NoError(t, err)
+	assert.Equal(t, "cpu,dc=b,host=a value=1.5 100\nmem used=3i", string(lp))
+}
+
+func TestStage(t *testing.T) {
+	err := edge.Permanent(edge.WithStage("json", errors.New("bad json")))
+	assert.True(t, edge.IsPermanent(err))
+	assert.Equal(t, "json", edge.Stage(err))
+	assert.EqualError(t, err, "bad json")
+	assert.Equal(t, "", edge.Stage(errors.New("bad json")))
+}
@@ -0,0 +1,152 @@
+/*
+Copyright 2022 Huawei Cloud Computing Technologies Co., Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package deadletter
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/openGemini/openGemini-forwarder/conf"
+	"github.com/openGemini/openGemini-forwarder/edge"
+)
+
+// Item is a record that failed for good, kept with enough context to be
+// replayed into its pipeline.
+type Item struct {
+	Pipeline string `json:"pipeline"`
+	// Stage is the name of the node that failed the record.
+	Stage   string      `json:"stage"`
+	Error   string      `json:"error"`
+	Source  edge.Source `json:"source"`
+	Payload []byte      `json:"payload"`
+	Time    time.Time   `json:"time"`
+}
+
+// NewItem returns the item of a record nacked with err.
+func NewItem(record *edge.Record, err error) *Item {
+	return &Item{
+		Stage:   edge.Stage(err),
+		Error:   err.Error(),
+		Source:  record.Source,
+		Payload: record.Payload,
+		Time:    time.Now(),
+	}
+}
+
+// Writer keeps the items written to it until they are replayed.
+type Writer interface {
+	// Write returns once the item is durable.
+	Write(item *Item) error
+}
+
+// Sink is where the dead letters are kept.
+type Sink interface {
+	Writer
+	// Replay hands the items to fn in batches, in the order they were
+	// written. fn returns the error each item failed with again, the items
+	// that did not fail are removed from the sink.
+	Replay(fn func(items []*Item) []error) error
+	Close() error
+}
+
+// NewSink returns the sink configured by c.
+func NewSink(c *conf.DeadLetter) (Sink, error) {
+	switch c.Sink {
+	case conf.DeadLetterSinkFile:
+		return NewFileSink(c.Dir, int64(c.MaxFileSize))
+	case conf.DeadLetterSinkKafka:
+		return NewKafkaSink(c.Brokers, c.Topic)
+	default:
+		return nil, fmt.Errorf("invalid dead-letter sink %q", c.Sink)
+	}
+}
+
+// User is implemented by the inputs that write the records failed for good
+// to a dead-letter writer instead of dropping or holding them.
+type User interface {
+	SetDeadLetter(w Writer)
+}
+
+type pipelineWriter struct {
+	Writer
+	pipeline string
+}
+
+func (w pipelineWriter) Write(item *Item) error {
+	item.Pipeline = w.pipeline
+	return w.Writer.Write(item)
+}
+
+// ForPipeline returns a writer that tags the items with the pipeline they
+// are replayed into.
+func ForPipeline(w Writer, pipeline string) Writer {
+	return pipelineWriter{Writer: w, pipeline: pipeline}
+}
+
+// Input is the node that emits the replayed records into a pipeline in place
+// of its inputs.
+type Input struct {
+	out edge.Edge
+}
+
+func (i *Input) Name() string {
+	return "dead_letter"
+}
+
+func (i *Input) Init() error {
+	return nil
+}
+
+func (i *Input) Start(_ edge.Edge, out edge.Edge) error {
+	i.out = out
+	return nil
+}
+
+func (i *Input) Stop() error {
+	return nil
+}
+
+// Replay sends the items of sink to the input of their pipeline and waits
+// for them to be done. Items that fail again are kept in the sink.
+func Replay(sink Sink, inputs map[string]*Input) error {
+	return sink.Replay(func(items []*Item) []error {
+		errs := make([]error, len(items))
+		var wg sync.WaitGroup
+		for i, item := range items {
+			in, ok := inputs[item.Pipeline]
+			if !ok {
+				errs[i] = fmt.Errorf("undefined pipeline %q", item.Pipeline)
+				continue
+			}
+
+			i := i
+			wg.Add(1)
+			in.out.In() <- &edge.Record{
+				Payload:  item.Payload,
+				Source:   item.Source,
+				Attempts: 1,
+				Done: func(_ *edge.Record, err error) {
+					errs[i] = err
+					wg.Done()
+				},
+			}
+		}
+		wg.Wait()
+		return errs
+	})
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2022 Huawei Cloud Computing Technologies Co., Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package deadletter_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/openGemini/openGemini-forwarder/edge"
+	"github.com/openGemini/openGemini-forwarder/lib/deadletter"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileSink(t *testing.T) {
+	dir := t.TempDir()
+	sink, err := deadletter.NewFileSink(dir, 1)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer sink.Close()
+
+	w := deadletter.ForPipeline(sink, "a")
+	for _, payload := range []string{"m1", "m2", "m3"} {
+		record := &edge.Record{Payload: []byte(payload), Source: edge.Source{Topic: "t", Offset: 1}}
+		err = w.Write(deadletter.NewItem(record, edge.WithStage("json", errors.New("bad json"))))
+		assert.NoError(t, err)
+	}
+	segments, _ := filepath.Glob(filepath.Join(dir, "*.dlq"))
+	assert.Equal(t, 3, len(segments))
+
+	var replayed []string
+	err = sink.Replay(func(items []*deadletter.Item) []error {
+		errs := make([]error, len(items))
+		for i, item := range items {
+			assert.Equal(t, "a", item.Pipeline)
+			assert.Equal(t, "json", item.Stage)
+			assert.Equal(t, "bad json", item.Error)
+			assert.Equal(t, "t", item.Source.Topic)
+			replayed = append(replayed, string(item.Payload))
+			if string(item.Payload) == "m2" {
+				errs[i] = edge.WithStage("openGemini", errors.New("timeout"))
+			}
+		}
+		return errs
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"m1", "m2", "m3"}, replayed)
+
+	segments, _ = filepath.Glob(filepath.Join(dir, "*.dlq"))
+	if assert.Equal(t, 1, len(segments)) {
+		data, err := os.ReadFile(segments[0])
+		assert.NoError(t, err)
+		assert.Contains(t, string(data), `"stage":"openGemini","error":"timeout"`)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	sink, err := deadletter.NewFileSink(t.TempDir(), 1024)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer sink.Close()
+	for _, pipeline := range []string{"a", "b", "c"} {
+		item := &deadletter.Item{Pipeline: pipeline, Payload: []byte(pipeline)}
+		assert.NoError(t, sink.Write(item))
+	}
+
+	inputs := map[string]*deadletter.Input{}
+	for _, pipeline := range []string{"a", "b"} {
+		e := edge.NewEdge(pipeline, 1)
+		in := &deadletter.Input{}
+		assert.NoError(t, in.Start(nil, e))
+		inputs[pipeline] = in
+		go func(fail bool) {
+			for r := range e.Out() {
+				if fail {
+					r.Nack(errors.New("write fail"))
+				} else {
+					r.Ack()
+				}
+			}
+		}(pipeline == "b")
+	}
+	assert.NoError(t, deadletter.Replay(sink, inputs))
+
+	var left []string
+	assert.NoError(t, sink.Replay(func(items []*deadletter.Item) []error {
+		for _, item := range items {
+			left = append(left, item.Pipeline+": "+item.Error)
+		}
+		return make([]error, len(items))
+	}))
+	assert.Equal(t, []string{`b: write fail`, `c: undefined pipeline "c"`}, left)
+}
@@ -0,0 +1,191 @@
+/*
+Copyright 2022 Huawei Cloud Computing Technologies Co., Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package deadletter
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/openGemini/openGemini-forwarder/edge"
+)
+
+const (
+	segmentExt = ".dlq"
+
+	// replayBatchSize is the number of items handed to the replay function
+	// at once.
+	replayBatchSize = 1000
+)
+
+// FileSink keeps the items as JSON lines in segment files of a directory.
+// A segment is rotated once it reaches the max size. Replay rewrites the
+// segments, it must not run while another process writes to the directory.
+type FileSink struct {
+	dir     string
+	maxSize int64
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+func NewFileSink(dir string, maxSize int64) (*FileSink, error) {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, err
+	}
+	return &FileSink{dir: dir, maxSize: maxSize}, nil
+}
+
+func (s *FileSink) Write(item *Item) error {
+	line, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil || s.size >= s.maxSize {
+		if err = s.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	if err != nil {
+		return err
+	}
+	return s.file.Sync()
+}
+
+func (s *FileSink) rotate() error {
+	if err := s.closeFile(); err != nil {
+		return err
+	}
+	name := filepath.Join(s.dir, fmt.Sprintf("%020d%s", time.Now().UnixNano(), segmentExt))
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		return err
+	}
+	s.file, s.size = f, 0
+	return nil
+}
+
+func (s *FileSink) closeFile() error {
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// Replay replays the segments from the oldest. A segment is removed once
+// all its items are replayed, or rewritten with the items that failed again.
+func (s *FileSink) Replay(fn func(items []*Item) []error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.closeFile(); err != nil {
+		return err
+	}
+
+	names, err := filepath.Glob(filepath.Join(s.dir, "*"+segmentExt))
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err = replaySegment(name, fn); err != nil {
+			return fmt.Errorf("replay %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+func replaySegment(name string, fn func(items []*Item) []error) error {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+
+	var items, failed []*Item
+	flush := func() {
+		for i, err := range fn(items) {
+			if err != nil {
+				failed = append(failed, failedAgain(items[i], err))
+			}
+		}
+		items = items[:0]
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, len(data)+1)
+	for scanner.Scan() {
+		item := &Item{}
+		if err = json.Unmarshal(scanner.Bytes(), item); err != nil {
+			return err
+		}
+		if items = append(items, item); len(items) == replayBatchSize {
+			flush()
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return err
+	}
+	if len(items) > 0 {
+		flush()
+	}
+
+	if len(failed) == 0 {
+		return os.Remove(name)
+	}
+	var buf []byte
+	for _, item := range failed {
+		line, err := json.Marshal(item)
+		if err != nil {
+			return err
+		}
+		buf = append(append(buf, line...), '\n')
+	}
+	tmp := name + ".tmp"
+	if err = os.WriteFile(tmp, buf, 0640); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+// failedAgain updates item with the error it failed with on replay.
+func failedAgain(item *Item, err error) *Item {
+	if stage := edge.Stage(err); stage != "" {
+		item.Stage = stage
+	}
+	item.Error = err.Error()
+	item.Time = time.Now()
+	return item
+}
+
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closeFile()
+}
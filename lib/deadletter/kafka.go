@@ -0,0 +1,223 @@
+/*
+Copyright 2022 Huawei Cloud Computing Technologies Co., Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package deadletter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+const (
+	headerPrefix    = "dead-letter-"
+	headerPipeline  = headerPrefix + "pipeline"
+	headerStage     = headerPrefix + "stage"
+	headerError     = headerPrefix + "error"
+	headerTopic     = headerPrefix + "topic"
+	headerPartition = headerPrefix + "partition"
+	headerOffset    = headerPrefix + "offset"
+	headerTimestamp = headerPrefix + "timestamp"
+
+	// replayGroup is the consumer group that commits the replayed offsets.
+	replayGroup = "forwarder_dead_letter_replay"
+)
+
+// KafkaSink keeps the items in a topic. The payload is the message value,
+// the rest of the item travels in headers, next to the headers of the
+// source message. Replay consumes the topic up to the end it had when the
+// replay started, items that fail again are produced to the topic again.
+type KafkaSink struct {
+	brokers  []string
+	topic    string
+	config   *sarama.Config
+	producer sarama.SyncProducer
+}
+
+func NewKafkaSink(brokers []string, topic string) (*KafkaSink, error) {
+	config := sarama.NewConfig()
+	// headers need 0.11
+	config.Version = sarama.V0_11_0_0
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	config.Producer.Return.Successes = true
+	config.Consumer.Offsets.Initial = sarama.OffsetOldest
+
+	producer, err := sarama.NewSyncProducer(brokers, config)
+	if err != nil {
+		return nil, err
+	}
+	return &KafkaSink{brokers: brokers, topic: topic, config: config, producer: producer}, nil
+}
+
+func (s *KafkaSink) Write(item *Item) error {
+	_, _, err := s.producer.SendMessage(s.message(item))
+	return err
+}
+
+func (s *KafkaSink) message(item *Item) *sarama.ProducerMessage {
+	headers := []sarama.RecordHeader{
+		{Key: []byte(headerPipeline), Value: []byte(item.Pipeline)},
+		{Key: []byte(headerStage), Value: []byte(item.Stage)},
+		{Key: []byte(headerError), Value: []byte(item.Error)},
+		{Key: []byte(headerTopic), Value: []byte(item.Source.Topic)},
+		{Key: []byte(headerPartition), Value: []byte(strconv.FormatInt(int64(item.Source.Partition), 10))},
+		{Key: []byte(headerOffset), Value: []byte(strconv.FormatInt(item.Source.Offset, 10))},
+		{Key: []byte(headerTimestamp), Value: []byte(strconv.FormatInt(item.Source.Timestamp.UnixNano(), 10))},
+	}
+	for k, v := range item.Source.Headers {
+		headers = append(headers, sarama.RecordHeader{Key: []byte(k), Value: []byte(v)})
+	}
+	return &sarama.ProducerMessage{
+		Topic:     s.topic,
+		Value:     sarama.ByteEncoder(item.Payload),
+		Headers:   headers,
+		Timestamp: item.Time,
+	}
+}
+
+// newItem decodes a message written by KafkaSink.
+func newItem(msg *sarama.ConsumerMessage) (*Item, error) {
+	item := &Item{Payload: msg.Value, Time: msg.Timestamp}
+	for _, h := range msg.Headers {
+		k, v := string(h.Key), string(h.Value)
+		var err error
+		switch k {
+		case headerPipeline:
+			item.Pipeline = v
+		case headerStage:
+			item.Stage = v
+		case headerError:
+			item.Error = v
+		case headerTopic:
+			item.Source.Topic = v
+		case headerPartition:
+			var p int64
+			p, err = strconv.ParseInt(v, 10, 32)
+			item.Source.Partition = int32(p)
+		case headerOffset:
+			item.Source.Offset, err = strconv.ParseInt(v, 10, 64)
+		case headerTimestamp:
+			var ns int64
+			ns, err = strconv.ParseInt(v, 10, 64)
+			item.Source.Timestamp = time.Unix(0, ns)
+		default:
+			if strings.HasPrefix(k, headerPrefix) {
+				continue
+			}
+			if item.Source.Headers == nil {
+				item.Source.Headers = make(map[string]string)
+			}
+			item.Source.Headers[k] = v
+		}
+		if err != nil {
+			return nil, fmt.Errorf("header %s: %v", k, err)
+		}
+	}
+	return item, nil
+}
+
+func (s *KafkaSink) Replay(fn func(items []*Item) []error) error {
+	client, err := sarama.NewClient(s.brokers, s.config)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	offsets, err := sarama.NewOffsetManagerFromClient(replayGroup, client)
+	if err != nil {
+		return err
+	}
+	defer offsets.Close()
+
+	consumer, err := sarama.NewConsumerFromClient(client)
+	if err != nil {
+		return err
+	}
+	defer consumer.Close()
+
+	partitions, err := client.Partitions(s.topic)
+	if err != nil {
+		return err
+	}
+	for _, p := range partitions {
+		if err = s.replayPartition(client, offsets, consumer, p, fn); err != nil {
+			return fmt.Errorf("replay partition %d: %v", p, err)
+		}
+	}
+	return nil
+}
+
+func (s *KafkaSink) replayPartition(client sarama.Client, offsets sarama.OffsetManager,
+	consumer sarama.Consumer, partition int32, fn func(items []*Item) []error) error {
+	end, err := client.GetOffset(s.topic, partition, sarama.OffsetNewest)
+	if err != nil {
+		return err
+	}
+	pom, err := offsets.ManagePartition(s.topic, partition)
+	if err != nil {
+		return err
+	}
+	defer pom.Close()
+
+	next, _ := pom.NextOffset()
+	if next < 0 {
+		if next, err = client.GetOffset(s.topic, partition, sarama.OffsetOldest); err != nil {
+			return err
+		}
+	}
+	if next >= end {
+		return nil
+	}
+
+	pc, err := consumer.ConsumePartition(s.topic, partition, next)
+	if err != nil {
+		return err
+	}
+	defer pc.Close()
+
+	var items []*Item
+	for next < end {
+		msg := <-pc.Messages()
+		item, err := newItem(msg)
+		if err != nil {
+			return fmt.Errorf("offset %d: %v", msg.Offset, err)
+		}
+		items = append(items, item)
+		next = msg.Offset + 1
+		if len(items) < replayBatchSize && next < end {
+			continue
+		}
+
+		for i, err := range fn(items) {
+			if err == nil {
+				continue
+			}
+			if err = s.Write(failedAgain(items[i], err)); err != nil {
+				return err
+			}
+		}
+		pom.MarkOffset(next, "")
+		items = items[:0]
+	}
+	return nil
+}
+
+func (s *KafkaSink) Close() error {
+	return s.producer.Close()
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2022 Huawei Cloud Computing Technologies Co., Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "forwarder"
+
+// Directions of the records counted by NodeRecords.
+const (
+	In      = "in"
+	Out     = "out"
+	Dropped = "dropped"
+)
+
+// Registry holds the metrics served on /metrics.
+var Registry = prometheus.NewRegistry()
+
+var (
+	// NodeRecords counts the records each node reads, emits and drops. The
+	// nodes are labeled with their alias, the edges of the disk buffer with
+	// their name.
+	NodeRecords = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "node_records_total",
+		Help:      "Records read, emitted and dropped by a node.",
+	}, []string{"node", "direction"})
+
+	// KafkaLag is the number of messages behind the high watermark of a
+	// partition.
+	KafkaLag = promauto.With(Registry).NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "kafka_consumer_lag",
+		Help:      "Messages behind the high watermark of a consumed partition.",
+	}, []string{"topic", "partition"})
+
+	// OutputWriteDuration observes the duration of the batch writes.
+	OutputWriteDuration = promauto.With(Registry).NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "output_write_duration_seconds",
+		Help:      "Duration of the batch writes of an output.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"output"})
+
+	// OutputWriteErrors counts the batch writes that failed.
+	OutputWriteErrors = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "output_write_errors_total",
+		Help:      "Batch writes of an output that failed.",
+	}, []string{"output"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Handler serves the metrics of Registry in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// NewDesc returns the description of a metric of the forwarder namespace.
+func NewDesc(name string, help string, labels []string) *prometheus.Desc {
+	return prometheus.NewDesc(prometheus.BuildFQName(namespace, "", name), help, labels, nil)
+}
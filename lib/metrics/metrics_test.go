@@ -0,0 +1,37 @@
+/*
+Copyright 2022 Huawei Cloud Computing Technologies Co., Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics_test
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/openGemini/openGemini-forwarder/lib/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandler(t *testing.T) {
+	metrics.NodeRecords.WithLabelValues("json", metrics.Dropped).Add(2)
+	metrics.KafkaLag.WithLabelValues("cpu", "0").Set(5)
+
+	w := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), `forwarder_node_records_total{direction="dropped",node="json"} 2`)
+	assert.Contains(t, w.Body.String(), `forwarder_kafka_consumer_lag{partition="0",topic="cpu"} 5`)
+	assert.Contains(t, w.Body.String(), "go_goroutines")
+}
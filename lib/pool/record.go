@@ -21,48 +21,56 @@ import (
 	"sync/atomic"
 
 	"github.com/openGemini/openGemini-forwarder/edge"
+	"github.com/openGemini/openGemini-forwarder/lib/metrics"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
-type KafkaRecordPool struct {
+type RecordPool struct {
 	pool *sync.Pool
 
 	hit   int64
 	total int64
 }
 
-var kafkaRecordPool *KafkaRecordPool
+var recordPool *RecordPool
 
 func init() {
-	kafkaRecordPool = &KafkaRecordPool{
+	recordPool = &RecordPool{
 		pool: new(sync.Pool),
 	}
+	metrics.Registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: "forwarder",
+		Name:      "record_pool_hit_ratio",
+		Help:      "Share of the records got from the pool that were reused.",
+	}, recordPool.HitRatio))
 }
 
-func NewKafkaRecordPool() *KafkaRecordPool {
-	return kafkaRecordPool
+func NewRecordPool() *RecordPool {
+	return recordPool
 }
 
-func (u *KafkaRecordPool) Get() *edge.KafkaRecord {
+func (u *RecordPool) Get() *edge.Record {
 	atomic.AddInt64(&u.total, 1)
 
-	v, ok := u.pool.Get().(*edge.KafkaRecord)
+	v, ok := u.pool.Get().(*edge.Record)
 	if !ok || v == nil {
-		return &edge.KafkaRecord{}
+		return &edge.Record{}
 	}
 
 	atomic.AddInt64(&u.hit, 1)
 	return v
 }
 
-func (u *KafkaRecordPool) Put(v *edge.KafkaRecord) {
-	if v.Session != nil {
-		v.Session.MarkMessage(v.Message, "")
-		v.Session = nil
-	}
-	v.Message = nil
+// Put resets v for reuse, v must be done.
+func (u *RecordPool) Put(v *edge.Record) {
+	v.Reset()
 	u.pool.Put(v)
 }
 
-func (u *KafkaRecordPool) HitRatio() float64 {
-	return float64(u.hit) / float64(u.total)
+func (u *RecordPool) HitRatio() float64 {
+	total := atomic.LoadInt64(&u.total)
+	if total == 0 {
+		return 0
+	}
+	return float64(atomic.LoadInt64(&u.hit)) / float64(total)
 }
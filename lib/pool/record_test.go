@@ -20,7 +20,6 @@ import (
 	"runtime/debug"
 	"testing"
 
-	"github.com/Shopify/sarama"
 	"github.com/openGemini/openGemini-forwarder/lib/pool"
 	"github.com/stretchr/testify/assert"
 )
@@ -30,15 +29,14 @@ func TestStringRecordPool(t *testing.T) {
 	debug.SetGCPercent(-1)
 	defer debug.SetGCPercent(100)
 
-	p := pool.NewKafkaRecordPool()
+	p := pool.NewRecordPool()
 	s := p.Get()
-	s.Message = &sarama.ConsumerMessage{}
-	s.Message.Value = make([]byte, 16)
-	assert.Equal(t, 16, cap(s.Message.Value))
+	s.Payload = make([]byte, 16)
+	assert.Equal(t, 16, cap(s.Payload))
 
 	p.Put(s)
 	s = p.Get()
-	if s.Message != nil {
+	if s.Payload != nil {
 		t.Error("cannot be")
 	}
 
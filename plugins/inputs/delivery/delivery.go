@@ -0,0 +1,108 @@
+/*
+Copyright 2022 Huawei Cloud Computing Technologies Co., Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package delivery
+
+import (
+	"context"
+	"time"
+
+	"github.com/openGemini/openGemini-forwarder/edge"
+	"github.com/openGemini/openGemini-forwarder/lib/deadletter"
+	"github.com/openGemini/openGemini-forwarder/lib/logger"
+	"github.com/openGemini/openGemini-forwarder/lib/metrics"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultMaxReplays is set on the inputs before their config is
+	// decoded, a max_replays of 0 disables the replays.
+	DefaultMaxReplays    = 3
+	DefaultReplayBackoff = time.Second
+)
+
+// Replayer settles the records of an input once every output has acked or
+// nacked them. A record that failed is sent into the pipeline again up to
+// MaxReplays times, after that it is written to the dead letters or held.
+// A record failed with a permanent error is not replayed, it is dropped if
+// it cannot be written to the dead letters.
+type Replayer struct {
+	// Node is the name of the input in the metrics.
+	Node          string
+	Out           edge.Edge
+	MaxReplays    int
+	ReplayBackoff time.Duration
+	DeadLetter    deadletter.Writer
+	// Held is logged when a record is held.
+	Held string
+	Log  *logger.Logger
+}
+
+// Done is called when every output has acked or nacked the record, with
+// the error of the first nack if any. delivered is called if the record no
+// longer has to be delivered, release once the input is done with it,
+// that is unless it is replayed and ctx is not done. fields describe the
+// record in the logs.
+func (r *Replayer) Done(ctx context.Context, record *edge.Record, err error, delivered, release func(), fields ...zap.Field) {
+	if err != nil && edge.IsPermanent(err) {
+		if !r.WriteDeadLetter(record, err, fields...) {
+			metrics.NodeRecords.WithLabelValues(r.Node, metrics.Dropped).Inc()
+			r.Log.Error("drop invalid record", append(fields, zap.Error(err))...)
+		}
+		delivered()
+		release()
+		return
+	}
+
+	if err != nil && record.Attempts <= r.MaxReplays && ctx.Err() == nil {
+		r.Log.Warn("deliver record fail, replay",
+			append(fields, zap.Int("attempts", record.Attempts), zap.Error(err))...)
+		record.Attempts++
+		time.AfterFunc(r.ReplayBackoff, func() {
+			select {
+			case r.Out.In() <- record:
+			case <-ctx.Done():
+				release()
+			}
+		})
+		return
+	}
+
+	switch {
+	case err == nil:
+		delivered()
+	case record.Attempts > r.MaxReplays && r.WriteDeadLetter(record, err, fields...):
+		delivered()
+	default:
+		r.Log.Error(r.Held, append(fields, zap.Int("attempts", record.Attempts), zap.Error(err))...)
+	}
+	release()
+}
+
+// WriteDeadLetter writes the record failed with err to the dead letters,
+// it returns false if there are none or the write fails.
+func (r *Replayer) WriteDeadLetter(record *edge.Record, err error, fields ...zap.Field) bool {
+	if r.DeadLetter == nil {
+		return false
+	}
+	if werr := r.DeadLetter.Write(deadletter.NewItem(record, err)); werr != nil {
+		r.Log.Error("write dead letter fail", append(fields, zap.Error(werr))...)
+		return false
+	}
+	r.Log.Warn("deliver record fail, move it to the dead letters",
+		append(fields, zap.Int("attempts", record.Attempts), zap.Error(err))...)
+	return true
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2022 Huawei Cloud Computing Technologies Co., Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package delivery_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/openGemini/openGemini-forwarder/edge"
+	"github.com/openGemini/openGemini-forwarder/lib/deadletter"
+	"github.com/openGemini/openGemini-forwarder/lib/logger"
+	"github.com/openGemini/openGemini-forwarder/plugins/inputs/delivery"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func init() {
+	logger.SetLogger(zap.NewNop())
+}
+
+type itemWriter []*deadletter.Item
+
+func (w *itemWriter) Write(item *deadletter.Item) error {
+	*w = append(*w, item)
+	return nil
+}
+
+func TestReplayer(t *testing.T) {
+	out := edge.NewEdge("out", 1)
+	r := &delivery.Replayer{
+		Node:          "test",
+		Out:           out,
+		MaxReplays:    1,
+		ReplayBackoff: time.Millisecond,
+		Held:          "hold",
+		Log:           logger.NewLogger("test"),
+	}
+	ctx := context.Background()
+	var delivered, released int
+	done := func(record *edge.Record, err error) {
+		r.Done(ctx, record, err, func() { delivered++ }, func() { released++ })
+	}
+
+	record := &edge.Record{Payload: []byte("a"), Attempts: 1}
+	done(record, errors.New("unavailable"))
+	assert.Same(t, record, <-out.Out())
+	assert.Equal(t, 2, record.Attempts)
+	assert.Equal(t, 0, released)
+
+	// held once the replays are spent
+	done(record, errors.New("unavailable"))
+	assert.Equal(t, 0, delivered)
+	assert.Equal(t, 1, released)
+
+	var w itemWriter
+	r.DeadLetter = &w
+	done(record, errors.New("unavailable"))
+	done(&edge.Record{Payload: []byte("b"), Attempts: 1}, edge.Permanent(errors.New("invalid")))
+	done(&edge.Record{Payload: []byte("c"), Attempts: 1}, nil)
+	assert.Equal(t, 3, delivered)
+	assert.Equal(t, 4, released)
+	if assert.Len(t, w, 2) {
+		assert.Equal(t, "a", string(w[0].Payload))
+		assert.Equal(t, "b", string(w[1].Payload))
+	}
+}
@@ -0,0 +1,513 @@
+/*
+Copyright 2022 Huawei Cloud Computing Technologies Co., Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package file
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	itoml "github.com/influxdata/influxdb/toml"
+	"github.com/openGemini/openGemini-forwarder/dag/node"
+	"github.com/openGemini/openGemini-forwarder/edge"
+	"github.com/openGemini/openGemini-forwarder/lib/deadletter"
+	"github.com/openGemini/openGemini-forwarder/lib/logger"
+	"github.com/openGemini/openGemini-forwarder/lib/metrics"
+	"github.com/openGemini/openGemini-forwarder/plugins/inputs"
+	"github.com/openGemini/openGemini-forwarder/plugins/inputs/delivery"
+	"go.uber.org/zap"
+)
+
+//go:embed sample.conf
+var sampleConfig string
+
+const (
+	nodeName = "file"
+
+	defaultLinesPerRecord        = 1
+	defaultMaxLineLen            = 1024 * 1024
+	defaultPollInterval          = time.Second
+	defaultMaxUndeliveredRecords = 1000
+	saveInterval                 = time.Second
+	cleanupTimeout               = 10 * time.Second
+)
+
+// Input emits the lines of the files matching globs, lines_per_record lines
+// per record. It reads the files once, or follows them as they grow when
+// tail is set. The position of each file is saved in the state file once
+// the lines before it are delivered, a restarted input resumes there. The
+// position is kept with a fingerprint of the first bytes of the file, a
+// file that no longer matches it, or shrank, is read again from its start.
+// The lines of a rotated file that are in flight at a restart are not read
+// again.
+type Input struct {
+	node.Alias
+
+	Files                 []string       `toml:"files"`
+	Tail                  bool           `toml:"tail"`
+	FromBeginning         bool           `toml:"from_beginning"`
+	StateFile             string         `toml:"state_file"`
+	LinesPerRecord        int            `toml:"lines_per_record"`
+	MaxLineLen            itoml.Size     `toml:"max_line_len"`
+	PollInterval          itoml.Duration `toml:"poll_interval"`
+	MaxUndeliveredRecords int            `toml:"max_undelivered_records"`
+	MaxReplays            int            `toml:"max_replays"`
+	ReplayBackoff         itoml.Duration `toml:"replay_backoff"`
+
+	log      *logger.Logger
+	state    *stateFile
+	out      edge.Edge
+	replayer delivery.Replayer
+
+	// ctx is cancelled by Stop, the context of the reading by Pause
+	ctx        context.Context
+	cancel     context.CancelFunc
+	readCancel context.CancelFunc
+	reading    sync.WaitGroup
+	inflight   sync.WaitGroup
+
+	followMu sync.Mutex
+	followed map[string]bool
+	// matched is the number of files the globs matched last
+	matched int32
+}
+
+func (i *Input) Name() string {
+	return nodeName
+}
+
+func (*Input) SampleConfig() string {
+	return sampleConfig
+}
+
+// Validate validates that the configuration is acceptable.
+func (i *Input) Validate() error {
+	if len(i.Files) == 0 {
+		return errors.New("no files")
+	}
+	for _, pattern := range i.Files {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid files pattern %q: %v", pattern, err)
+		}
+	}
+	if i.LinesPerRecord < 0 {
+		return fmt.Errorf("invalid lines_per_record %d", i.LinesPerRecord)
+	}
+	if i.MaxUndeliveredRecords < 0 {
+		return fmt.Errorf("invalid max_undelivered_records %d", i.MaxUndeliveredRecords)
+	}
+	if i.MaxReplays < 0 {
+		return fmt.Errorf("invalid max_replays %d", i.MaxReplays)
+	}
+	return nil
+}
+
+func (i *Input) Init() error {
+	if err := i.Validate(); err != nil {
+		return err
+	}
+	i.log = logger.NewLogger(i.Name())
+
+	if i.LinesPerRecord == 0 {
+		i.LinesPerRecord = defaultLinesPerRecord
+	}
+	if i.MaxLineLen == 0 {
+		i.MaxLineLen = itoml.Size(defaultMaxLineLen)
+	}
+	if i.PollInterval == 0 {
+		i.PollInterval = itoml.Duration(defaultPollInterval)
+	}
+	if i.MaxUndeliveredRecords == 0 {
+		i.MaxUndeliveredRecords = defaultMaxUndeliveredRecords
+	}
+	if i.ReplayBackoff == 0 {
+		i.ReplayBackoff = itoml.Duration(delivery.DefaultReplayBackoff)
+	}
+	return nil
+}
+
+func (i *Input) Start(_ edge.Edge, out edge.Edge) error {
+	state, err := loadState(i.StateFile)
+	if err != nil {
+		return err
+	}
+	i.state = state
+	i.out = out
+	i.replayer.Node = i.AliasOr(nodeName)
+	i.replayer.Out = out
+	i.replayer.MaxReplays = i.MaxReplays
+	i.replayer.ReplayBackoff = time.Duration(i.ReplayBackoff)
+	i.replayer.Held = "deliver record fail, hold the position of the file"
+	i.replayer.Log = i.log
+	i.followed = make(map[string]bool)
+	i.ctx, i.cancel = context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(i.ctx)
+	i.readCancel = cancel
+
+	i.reading.Add(2)
+	go func() {
+		defer i.reading.Done()
+		i.saveLoop(ctx)
+	}()
+	go func() {
+		defer i.reading.Done()
+		if i.Tail {
+			i.watch(ctx)
+		} else {
+			i.readAll(ctx)
+		}
+	}()
+	return nil
+}
+
+// SetDeadLetter makes the input write the records that fail for good to w
+// instead of dropping them or holding the position of their file.
+func (i *Input) SetDeadLetter(w deadletter.Writer) {
+	i.replayer.DeadLetter = w
+}
+
+// Check reports whether the globs match files.
+func (i *Input) Check() error {
+	if atomic.LoadInt32(&i.matched) == 0 {
+		return fmt.Errorf("no file matches %v", i.Files)
+	}
+	return nil
+}
+
+// Pause stops reading the files, the positions of the records in flight
+// are still saved by Stop.
+func (i *Input) Pause() error {
+	if i.readCancel != nil {
+		i.readCancel()
+	}
+	return nil
+}
+
+// Stop waits for the records in flight to be delivered and saves the
+// positions of the files.
+func (i *Input) Stop() error {
+	if i.cancel == nil {
+		return nil
+	}
+	i.readCancel()
+	i.reading.Wait()
+
+	done := make(chan struct{})
+	go func() {
+		i.inflight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(cleanupTimeout):
+		i.log.Warn("records are still in flight, the positions of their files are not saved")
+	}
+	i.cancel()
+	i.cancel = nil
+	return i.state.save()
+}
+
+func (i *Input) saveLoop(ctx context.Context) {
+	ticker := time.NewTicker(saveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := i.state.save(); err != nil {
+				i.log.Error("save state", zap.String("path", i.StateFile), zap.Error(err))
+			}
+		}
+	}
+}
+
+// glob returns the regular files the globs match.
+func (i *Input) glob() []string {
+	seen := make(map[string]bool)
+	var paths []string
+	for _, pattern := range i.Files {
+		matches, _ := filepath.Glob(pattern)
+		for _, path := range matches {
+			if abs, err := filepath.Abs(path); err == nil {
+				path = abs
+			}
+			if seen[path] {
+				continue
+			}
+			if st, err := os.Stat(path); err != nil || !st.Mode().IsRegular() {
+				continue
+			}
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+	atomic.StoreInt32(&i.matched, int32(len(paths)))
+	return paths
+}
+
+// readAll reads the files to their end, one after the other.
+func (i *Input) readAll(ctx context.Context) {
+	for _, path := range i.glob() {
+		if err := i.readFile(ctx, path); err != nil {
+			i.log.Error("read file", zap.String("file", path), zap.Error(err))
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+func (i *Input) readFile(ctx context.Context, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	offset, err := i.position(path, f, false)
+	if err != nil {
+		return err
+	}
+	r, err := newLineReader(f, offset, int(i.MaxLineLen))
+	if err != nil {
+		return err
+	}
+	_, err = i.readLines(ctx, path, r, newTracker(path, f, i.state, i.MaxUndeliveredRecords, nil), true)
+	return err
+}
+
+// watch follows the files the globs match, checking for new ones every
+// poll interval. The files created meanwhile are read from their start.
+func (i *Input) watch(ctx context.Context) {
+	fromEnd := !i.FromBeginning
+	for {
+		for _, path := range i.glob() {
+			i.followMu.Lock()
+			followed := i.followed[path]
+			i.followed[path] = true
+			i.followMu.Unlock()
+			if followed {
+				continue
+			}
+			i.reading.Add(1)
+			go func(path string, fromEnd bool) {
+				defer i.reading.Done()
+				i.follow(ctx, path, fromEnd)
+				i.followMu.Lock()
+				delete(i.followed, path)
+				i.followMu.Unlock()
+			}(path, fromEnd)
+		}
+		fromEnd = false
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Duration(i.PollInterval)):
+		}
+	}
+}
+
+// follow emits the lines of path as they are written, from its end if
+// fromEnd is set and no position is saved, until ctx is done or the file is
+// removed. A file replaced at path, as by a rotation, is
+// read to its end before the new one is read from its start, a truncated
+// file is read again from its start.
+func (i *Input) follow(ctx context.Context, path string, fromEnd bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		i.log.Error("open file", zap.String("file", path), zap.Error(err))
+		return
+	}
+	defer func() {
+		if f != nil {
+			f.Close()
+		}
+	}()
+	offset, err := i.position(path, f, fromEnd)
+	if err != nil {
+		i.log.Error("open file", zap.String("file", path), zap.Error(err))
+		return
+	}
+
+	var tr *tracker
+	for {
+		r, err := newLineReader(f, offset, int(i.MaxLineLen))
+		if err != nil {
+			i.log.Error("read file", zap.String("file", path), zap.Error(err))
+			return
+		}
+		// the records in flight of a rotated or truncated file move its
+		// position until the first record of the next one is delivered
+		tr = newTracker(path, f, i.state, i.MaxUndeliveredRecords, tr)
+		if !i.followFile(ctx, path, f, r, tr) {
+			return
+		}
+		offset = 0
+
+		st, err := f.Stat()
+		if err != nil {
+			i.log.Error("read file", zap.String("file", path), zap.Error(err))
+			return
+		}
+		if st.Size() >= r.offset {
+			// rotated
+			f.Close()
+			if f, err = os.Open(path); err != nil {
+				// removed, the glob finds it again once it is created
+				return
+			}
+		}
+	}
+}
+
+// followFile emits the lines of f until ctx is done, then returns false,
+// or until path is no longer f or f is truncated, then returns true once
+// the lines of f are read.
+func (i *Input) followFile(ctx context.Context, path string, f *os.File, r *lineReader, tr *tracker) bool {
+	for {
+		if ok, err := i.readLines(ctx, path, r, tr, false); !ok || err != nil {
+			if err != nil {
+				i.log.Error("read file", zap.String("file", path), zap.Error(err))
+			}
+			return false
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(time.Duration(i.PollInterval)):
+		}
+
+		fst, err := f.Stat()
+		if err != nil {
+			i.log.Error("read file", zap.String("file", path), zap.Error(err))
+			return false
+		}
+		if fst.Size() < r.offset {
+			return true
+		}
+		if st, err := os.Stat(path); (err != nil && os.IsNotExist(err)) || (err == nil && !os.SameFile(st, fst)) {
+			ok, err := i.readLines(ctx, path, r, tr, true)
+			if err != nil {
+				i.log.Error("read file", zap.String("file", path), zap.Error(err))
+			}
+			return ok
+		}
+	}
+}
+
+// position returns the offset the reading of path resumes at, the end of
+// f if fromEnd is set and no position is saved.
+func (i *Input) position(path string, f *os.File, fromEnd bool) (int64, error) {
+	st, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if pos, ok := i.state.get(path); ok {
+		if pos.Offset > st.Size() || !pos.matches(f) {
+			// truncated or replaced
+			return 0, nil
+		}
+		return pos.Offset, nil
+	}
+	if fromEnd {
+		return st.Size(), nil
+	}
+	return 0, nil
+}
+
+// readLines emits the complete lines of r, and the last one without
+// newline if final is set. It returns false if ctx is done.
+func (i *Input) readLines(ctx context.Context, path string, r *lineReader, tr *tracker, final bool) (bool, error) {
+	for {
+		start := r.offset
+		var payload []byte
+		lines := 0
+		end := false
+		for lines < i.LinesPerRecord {
+			line, ok, err := r.next(final)
+			if err != nil {
+				return true, err
+			}
+			if !ok {
+				end = true
+				break
+			}
+			if len(bytes.TrimSpace(line)) == 0 {
+				continue
+			}
+			if lines > 0 {
+				payload = append(payload, '\n')
+			}
+			payload = append(payload, line...)
+			lines++
+		}
+		if r.skipped > 0 {
+			metrics.NodeRecords.WithLabelValues(i.AliasOr(nodeName), metrics.Dropped).Add(float64(r.skipped))
+			i.log.Warn("skip lines longer than max_line_len",
+				zap.String("file", path), zap.Int("lines", r.skipped))
+			r.skipped = 0
+		}
+
+		if r.offset > start {
+			if !tr.add(ctx, start, r.offset) {
+				return false, nil
+			}
+			if lines == 0 {
+				tr.delivered(start)
+			} else if !i.emit(ctx, tr, path, payload, start) {
+				return false, nil
+			}
+		}
+		if end {
+			return ctx.Err() == nil, nil
+		}
+	}
+}
+
+func (i *Input) emit(ctx context.Context, tr *tracker, path string, payload []byte, start int64) bool {
+	record := &edge.Record{
+		Payload:  payload,
+		Source:   edge.Source{Topic: path, Offset: start, Timestamp: time.Now()},
+		Attempts: 1,
+	}
+	record.Done = func(r *edge.Record, err error) {
+		i.replayer.Done(i.ctx, r, err, func() { tr.delivered(start) }, i.inflight.Done,
+			zap.String("file", path), zap.Int64("offset", start))
+	}
+	i.inflight.Add(1)
+	select {
+	case i.out.In() <- record:
+		metrics.NodeRecords.WithLabelValues(i.AliasOr(nodeName), metrics.Out).Inc()
+		return true
+	case <-ctx.Done():
+		i.inflight.Done()
+		return false
+	}
+}
+
+func init() {
+	inputs.Add(nodeName, func() node.Node {
+		return &Input{MaxReplays: delivery.DefaultMaxReplays}
+	})
+}
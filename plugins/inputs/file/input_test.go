@@ -0,0 +1,220 @@
+/*
+Copyright 2022 Huawei Cloud Computing Technologies Co., Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package file_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	itoml "github.com/influxdata/influxdb/toml"
+	"github.com/openGemini/openGemini-forwarder/edge"
+	"github.com/openGemini/openGemini-forwarder/lib/logger"
+	"github.com/openGemini/openGemini-forwarder/plugins/inputs"
+	"github.com/openGemini/openGemini-forwarder/plugins/inputs/file"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func init() {
+	logger.SetLogger(zap.NewNop())
+}
+
+func newInput(t *testing.T, configure func(i *file.Input)) (*file.Input, edge.Edge) {
+	i := inputs.GetInputs()["file"]().(*file.Input)
+	i.PollInterval = itoml.Duration(10 * time.Millisecond)
+	configure(i)
+	if err := i.Init(); err != nil {
+		t.Fatal(err)
+	}
+	out := edge.NewEdge("out", 10)
+	if err := i.Start(nil, out); err != nil {
+		t.Fatal(err)
+	}
+	return i, out
+}
+
+func receive(t *testing.T, e edge.Edge) *edge.Record {
+	t.Helper()
+	select {
+	case r := <-e.Out():
+		return r
+	case <-time.After(5 * time.Second):
+		t.Fatal("no record")
+		return nil
+	}
+}
+
+// assertLine asserts that the next record of e is line and acks it.
+func assertLine(t *testing.T, e edge.Edge, line string) {
+	t.Helper()
+	r := receive(t, e)
+	assert.Equal(t, line, string(r.Payload))
+	r.Ack()
+}
+
+func appendFile(t *testing.T, path, data string) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInputRead(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.lp")
+	appendFile(t, path, "m v=1\nm v=2\n\nm v=3\nm v=4")
+	configure := func(i *file.Input) {
+		i.Files = []string{filepath.Join(dir, "*.lp")}
+		i.StateFile = filepath.Join(dir, "state", "file.json")
+		i.LinesPerRecord = 2
+	}
+
+	i, out := newInput(t, configure)
+	r := receive(t, out)
+	assert.Equal(t, "m v=1\nm v=2", string(r.Payload))
+	assert.Equal(t, path, r.Source.Topic)
+	r.Ack()
+	r = receive(t, out)
+	assert.Equal(t, "m v=3\nm v=4", string(r.Payload))
+	r.Ack()
+	assert.NoError(t, i.Check())
+	assert.NoError(t, i.Stop())
+
+	// the restarted input resumes after the delivered lines
+	appendFile(t, path, "\nm v=5\n")
+	i, out = newInput(t, configure)
+	r = receive(t, out)
+	assert.Equal(t, "m v=5", string(r.Payload))
+	r.Nack(edge.Permanent(errors.New("invalid")))
+	assert.NoError(t, i.Stop())
+
+	i, out = newInput(t, configure)
+	defer i.Stop()
+	select {
+	case r := <-out.Out():
+		t.Fatalf("read again %q", r.Payload)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestInputReplaced(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.lp")
+	appendFile(t, path, "m v=1\n")
+	configure := func(i *file.Input) {
+		i.Files = []string{path}
+		i.StateFile = filepath.Join(dir, "file.json")
+	}
+
+	i, out := newInput(t, configure)
+	receive(t, out).Ack()
+	assert.NoError(t, i.Stop())
+
+	// a file replaced while stopped is read from its start, even if it is
+	// longer than the saved position
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendFile(t, path, "n v=1\nn v=2\n")
+	i, out = newInput(t, configure)
+	defer i.Stop()
+	assertLine(t, out, "n v=1")
+	assertLine(t, out, "n v=2")
+}
+
+func TestInputHold(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.lp")
+	appendFile(t, path, "m v=1\nm v=2\n")
+	configure := func(i *file.Input) {
+		i.Files = []string{path}
+		i.StateFile = filepath.Join(dir, "file.json")
+		i.MaxReplays = 1
+		i.ReplayBackoff = itoml.Duration(time.Millisecond)
+	}
+
+	i, out := newInput(t, configure)
+	r := receive(t, out)
+	assert.Equal(t, "m v=1", string(r.Payload))
+	r.Nack(errors.New("unavailable"))
+	receive(t, out).Ack()
+	r = receive(t, out)
+	assert.Equal(t, "m v=1", string(r.Payload))
+	assert.Equal(t, 2, r.Attempts)
+	r.Nack(errors.New("unavailable"))
+	assert.NoError(t, i.Stop())
+
+	// the position is held before the failed line
+	i, out = newInput(t, configure)
+	defer i.Stop()
+	assertLine(t, out, "m v=1")
+	assertLine(t, out, "m v=2")
+}
+
+func TestInputTail(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.log")
+	appendFile(t, path, "old v=1\n")
+	i, out := newInput(t, func(i *file.Input) {
+		i.Files = []string{filepath.Join(dir, "*.log")}
+		i.Tail = true
+	})
+	defer i.Stop()
+	time.Sleep(50 * time.Millisecond)
+
+	// partial lines wait for their newline
+	appendFile(t, path, "m v=1\nm v=")
+	assertLine(t, out, "m v=1")
+	appendFile(t, path, "2\n")
+	assertLine(t, out, "m v=2")
+
+	// rotated, the new file is read from its start
+	appendFile(t, path, "m v=3\n")
+	assertLine(t, out, "m v=3")
+	if err := os.Rename(path, filepath.Join(dir, "a.log.1")); err != nil {
+		t.Fatal(err)
+	}
+	appendFile(t, path, "m v=4\n")
+	assertLine(t, out, "m v=4")
+
+	// truncated
+	time.Sleep(50 * time.Millisecond)
+	if err := os.Truncate(path, 0); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	appendFile(t, path, "m v=5\n")
+	assertLine(t, out, "m v=5")
+
+	// new files
+	appendFile(t, filepath.Join(dir, "b.log"), "m v=6\n")
+	assertLine(t, out, "m v=6")
+}
+
+func TestInputValidate(t *testing.T) {
+	assert.Error(t, (&file.Input{}).Validate())
+	assert.Error(t, (&file.Input{Files: []string{"[a"}}).Validate())
+	assert.Error(t, (&file.Input{Files: []string{"*.lp"}, LinesPerRecord: -1}).Validate())
+	assert.NoError(t, (&file.Input{Files: []string{"*.lp"}}).Validate())
+}
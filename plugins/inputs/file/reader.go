@@ -0,0 +1,113 @@
+/*
+Copyright 2022 Huawei Cloud Computing Technologies Co., Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package file
+
+import (
+	"bytes"
+	"io"
+	"os"
+)
+
+const readSize = 64 * 1024
+
+// lineReader reads the complete lines of a file. A line longer than max is
+// skipped up to its newline.
+type lineReader struct {
+	f   *os.File
+	max int
+	// offset is the file offset of buf[0], the end of the lines returned
+	offset int64
+	buf    []byte
+	// eof is set once a read reached the end of the file
+	eof bool
+	// skipping is set while the rest of a long line is skipped
+	skipping bool
+	// skipped counts the long lines skipped
+	skipped int
+}
+
+func newLineReader(f *os.File, offset int64, max int) (*lineReader, error) {
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return &lineReader{f: f, max: max, offset: offset}, nil
+}
+
+// next returns the next line without its line ending, or false at the end
+// of the complete lines. The bytes of a last line without newline are only
+// returned if final is set.
+func (r *lineReader) next(final bool) ([]byte, bool, error) {
+	for {
+		if i := bytes.IndexByte(r.buf, '\n'); i >= 0 {
+			line := r.buf[:i]
+			r.buf = r.buf[i+1:]
+			r.offset += int64(i + 1)
+			if r.skipping {
+				r.skipping = false
+				continue
+			}
+			if r.max > 0 && len(line) > r.max {
+				r.skipped++
+				continue
+			}
+			return bytes.TrimSuffix(line, []byte{'\r'}), true, nil
+		}
+		if r.max > 0 && len(r.buf) > r.max {
+			if !r.skipping {
+				r.skipped++
+			}
+			r.skipping = true
+			r.offset += int64(len(r.buf))
+			r.buf = r.buf[:0]
+		}
+		if r.eof {
+			r.eof = false
+			if !final || len(r.buf) == 0 {
+				return nil, false, nil
+			}
+			line := r.buf
+			r.offset += int64(len(line))
+			r.buf = nil
+			if r.skipping || (r.max > 0 && len(line) > r.max) {
+				if !r.skipping {
+					r.skipped++
+				}
+				r.skipping = false
+				return nil, false, nil
+			}
+			return bytes.TrimSuffix(line, []byte{'\r'}), true, nil
+		}
+		if err := r.fill(); err != nil {
+			return nil, false, err
+		}
+	}
+}
+
+func (r *lineReader) fill() error {
+	if cap(r.buf)-len(r.buf) < readSize {
+		buf := make([]byte, len(r.buf), len(r.buf)+readSize)
+		copy(buf, r.buf)
+		r.buf = buf
+	}
+	n, err := r.f.Read(r.buf[len(r.buf):cap(r.buf)])
+	r.buf = r.buf[:len(r.buf)+n]
+	if err == io.EOF || (err == nil && n == 0) {
+		r.eof = true
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,271 @@
+/*
+Copyright 2022 Huawei Cloud Computing Technologies Co., Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// fingerprintSize is the number of bytes at the start of a file that
+// identify it.
+const fingerprintSize = 1024
+
+// position is the offset up to which the lines of a file were delivered,
+// with the fingerprint of the file it belongs to.
+type position struct {
+	Offset int64 `json:"offset"`
+	// Fingerprint is the hash of the first FingerprintLen bytes of the file.
+	Fingerprint    uint64 `json:"fingerprint"`
+	FingerprintLen int64  `json:"fingerprint_len"`
+}
+
+// matches reports whether f is the file of the position.
+func (p position) matches(f *os.File) bool {
+	fp, n, err := fingerprint(f, p.FingerprintLen)
+	return err == nil && n == p.FingerprintLen && fp == p.Fingerprint
+}
+
+// fingerprint returns the hash of the first n bytes of f, at most
+// fingerprintSize, and the number of bytes hashed.
+func fingerprint(f *os.File, n int64) (uint64, int64, error) {
+	if n > fingerprintSize {
+		n = fingerprintSize
+	}
+	buf := make([]byte, n)
+	read, err := f.ReadAt(buf, 0)
+	if err == io.EOF {
+		err = nil
+	}
+	h := fnv.New64a()
+	h.Write(buf[:read])
+	return h.Sum64(), int64(read), err
+}
+
+// stateFile keeps the positions up to which the lines of the files were
+// delivered, so that a restarted input resumes there. The positions are
+// only kept in memory if path is empty.
+type stateFile struct {
+	path string
+
+	mu        sync.Mutex
+	positions map[string]position
+	dirty     bool
+}
+
+type stateContent struct {
+	Files map[string]position `json:"files"`
+}
+
+func loadState(path string) (*stateFile, error) {
+	s := &stateFile{path: path, positions: make(map[string]position)}
+	if path == "" {
+		return s, nil
+	}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var content stateContent
+	if err := json.Unmarshal(b, &content); err != nil {
+		return nil, fmt.Errorf("state file %s: %v", path, err)
+	}
+	for k, v := range content.Files {
+		s.positions[k] = v
+	}
+	return s, nil
+}
+
+func (s *stateFile) get(file string) (position, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pos, ok := s.positions[file]
+	return pos, ok
+}
+
+func (s *stateFile) set(file string, pos position) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if old, ok := s.positions[file]; ok && old == pos {
+		return
+	}
+	s.positions[file] = pos
+	s.dirty = true
+}
+
+// save writes the positions to the state file if they changed, through a
+// temporary file renamed over it.
+func (s *stateFile) save() error {
+	s.mu.Lock()
+	if !s.dirty || s.path == "" {
+		s.mu.Unlock()
+		return nil
+	}
+	b, err := json.Marshal(stateContent{Files: s.positions})
+	s.dirty = false
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0750); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0640); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		s.mu.Lock()
+		s.dirty = true
+		s.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+type pendingRecord struct {
+	start     int64
+	end       int64
+	delivered bool
+}
+
+// tracker moves the position of a file in the state only when every record
+// read before has been delivered, so that a record still in flight or
+// failed is read again after a restart. There is one tracker per opened
+// file. The one of a rotated file keeps moving the position until the
+// tracker of the file that replaced it, its next, moves it.
+type tracker struct {
+	file  string
+	f     *os.File
+	state *stateFile
+	// limit bounds the pending records, so that a failed record whose
+	// position is held stops the reading of the file.
+	limit int
+	prev  *tracker
+
+	mu       sync.Mutex
+	pending  []pendingRecord
+	trimmed  chan struct{}
+	detached bool
+	// fingerprint of the first fpLen bytes of f
+	fp    uint64
+	fpLen int64
+}
+
+// newTracker returns the tracker of f, read at file, that detaches prev,
+// the tracker of the file f replaced if any, once it moves the position.
+func newTracker(file string, f *os.File, state *stateFile, limit int, prev *tracker) *tracker {
+	t := &tracker{file: file, f: f, state: state, limit: limit, prev: prev}
+	t.fp, t.fpLen, _ = fingerprint(f, fingerprintSize)
+	return t
+}
+
+// add registers the record of the bytes [start, end) of the file. It waits
+// while the file has too many pending records and returns false if ctx is
+// done meanwhile.
+func (t *tracker) add(ctx context.Context, start, end int64) bool {
+	for {
+		t.mu.Lock()
+		if t.limit <= 0 || len(t.pending) < t.limit {
+			t.pending = append(t.pending, pendingRecord{start: start, end: end})
+			t.mu.Unlock()
+			return true
+		}
+		if t.trimmed == nil {
+			t.trimmed = make(chan struct{})
+		}
+		trimmed := t.trimmed
+		t.mu.Unlock()
+
+		select {
+		case <-trimmed:
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// delivered records that the record starting at start was delivered and
+// moves the position of the file up to the first record that is not.
+func (t *tracker) delivered(start int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	i := 0
+	for i < len(t.pending) && t.pending[i].start != start {
+		i++
+	}
+	if i == len(t.pending) {
+		return
+	}
+	t.pending[i].delivered = true
+
+	n := 0
+	for n < len(t.pending) && t.pending[n].delivered {
+		n++
+	}
+	if n == 0 {
+		return
+	}
+	if !t.detached {
+		if t.prev != nil {
+			t.prev.detach()
+			t.prev = nil
+		}
+		t.state.set(t.file, t.position(t.pending[n-1].end))
+	}
+	t.pending = t.pending[n:]
+	if t.trimmed != nil {
+		close(t.trimmed)
+		t.trimmed = nil
+	}
+}
+
+// position returns the position of the file at off. The fingerprint is
+// extended while the file grows, it is kept once the file is closed.
+func (t *tracker) position(off int64) position {
+	if t.fpLen < fingerprintSize && t.fpLen < off {
+		if fp, n, err := fingerprint(t.f, off); err == nil {
+			t.fp, t.fpLen = fp, n
+		}
+	}
+	return position{Offset: off, Fingerprint: t.fp, FingerprintLen: t.fpLen}
+}
+
+// detach stops the tracker, and the ones it would detach, from moving the
+// position of the file.
+func (t *tracker) detach() {
+	t.mu.Lock()
+	t.detached = true
+	prev := t.prev
+	t.prev = nil
+	t.mu.Unlock()
+	if prev != nil {
+		prev.detach()
+	}
+}
@@ -0,0 +1,160 @@
+/*
+Copyright 2022 Huawei Cloud Computing Technologies Co., Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package file
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func openFile(t *testing.T, path, content string) *os.File {
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+func TestTracker(t *testing.T) {
+	dir := t.TempDir()
+	state, err := loadState(filepath.Join(dir, "state"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	f := openFile(t, filepath.Join(dir, "a.lp"), "m v=1\nm v=2\nm v=3\n")
+	tr := newTracker("a.lp", f, state, 0, nil)
+	ctx := context.Background()
+	tr.add(ctx, 0, 6)
+	tr.add(ctx, 6, 12)
+	tr.add(ctx, 12, 18)
+
+	tr.delivered(6)
+	_, ok := state.get("a.lp")
+	assert.False(t, ok)
+	tr.delivered(0)
+	pos, _ := state.get("a.lp")
+	assert.Equal(t, int64(12), pos.Offset)
+	assert.Equal(t, int64(18), pos.FingerprintLen)
+	assert.True(t, pos.matches(f))
+
+	tr.detach()
+	tr.delivered(12)
+	pos, _ = state.get("a.lp")
+	assert.Equal(t, int64(12), pos.Offset)
+
+	assert.NoError(t, state.save())
+	state, err = loadState(state.path)
+	if assert.NoError(t, err) {
+		pos, _ = state.get("a.lp")
+		assert.Equal(t, int64(12), pos.Offset)
+		assert.True(t, pos.matches(f))
+		assert.False(t, pos.matches(openFile(t, filepath.Join(dir, "b.lp"), "n v=1\nn v=2\n")))
+	}
+}
+
+func TestTrackerRotated(t *testing.T) {
+	dir := t.TempDir()
+	state, _ := loadState("")
+	ctx := context.Background()
+	old := newTracker("a.lp", openFile(t, filepath.Join(dir, "a.lp.1"), "m v=1\nm v=2\n"), state, 0, nil)
+	old.add(ctx, 0, 6)
+	old.add(ctx, 6, 12)
+	old.delivered(0)
+
+	// the old file keeps its position until the new one moves it
+	f := openFile(t, filepath.Join(dir, "a.lp"), "n v=1\n")
+	tr := newTracker("a.lp", f, state, 0, old)
+	tr.add(ctx, 0, 6)
+	old.delivered(6)
+	pos, _ := state.get("a.lp")
+	assert.Equal(t, int64(12), pos.Offset)
+	assert.False(t, pos.matches(f))
+
+	tr.delivered(0)
+	pos, _ = state.get("a.lp")
+	assert.Equal(t, int64(6), pos.Offset)
+	assert.True(t, pos.matches(f))
+	old.add(ctx, 12, 18)
+	old.delivered(12)
+	pos, _ = state.get("a.lp")
+	assert.Equal(t, int64(6), pos.Offset)
+}
+
+func TestTrackerLimit(t *testing.T) {
+	state, _ := loadState("")
+	tr := newTracker("a.lp", openFile(t, filepath.Join(t.TempDir(), "a.lp"), ""), state, 1, nil)
+	assert.True(t, tr.add(context.Background(), 0, 10))
+
+	added := make(chan bool)
+	go func() {
+		added <- tr.add(context.Background(), 10, 20)
+	}()
+	select {
+	case <-added:
+		t.Fatal("added past the limit")
+	case <-time.After(20 * time.Millisecond):
+	}
+	tr.delivered(0)
+	assert.True(t, <-added)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.False(t, tr.add(ctx, 20, 30))
+}
+
+func TestLineReader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.lp")
+	if err := os.WriteFile(path, []byte("a\r\n\nlong line\nb\nc"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := newLineReader(f, 0, 4)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var lines []string
+	for {
+		line, ok, err := r.next(false)
+		if !assert.NoError(t, err) || !ok {
+			break
+		}
+		lines = append(lines, string(line))
+	}
+	assert.Equal(t, []string{"a", "", "b"}, lines)
+	assert.Equal(t, 1, r.skipped)
+	assert.Equal(t, int64(16), r.offset)
+
+	line, ok, err := r.next(true)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "c", string(line))
+	assert.Equal(t, int64(17), r.offset)
+}
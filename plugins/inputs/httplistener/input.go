@@ -0,0 +1,113 @@
+/*
+Copyright 2022 Huawei Cloud Computing Technologies Co., Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package httplistener
+
+import (
+	_ "embed"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/influxdata/influxdb/models"
+	"github.com/openGemini/openGemini-forwarder/dag/node"
+	"github.com/openGemini/openGemini-forwarder/edge"
+	"github.com/openGemini/openGemini-forwarder/plugins/inputs"
+	"github.com/openGemini/openGemini-forwarder/plugins/inputs/listener"
+)
+
+//go:embed sample.conf
+var sampleConfig string
+
+const defaultPath = "/write"
+
+// precisions maps the precision parameter of the write api to the one of
+// the line protocol parser.
+var precisions = map[string]string{
+	"":   "n",
+	"n":  "n",
+	"ns": "n",
+	"u":  "u",
+	"us": "u",
+	"ms": "ms",
+	"s":  "s",
+	"m":  "m",
+	"h":  "h",
+}
+
+// Input receives line protocol on the /write api of InfluxDB and openGemini.
+// The lines of a request are emitted as one record with nanosecond
+// timestamps, the lines without timestamp get the time of the request. A
+// request with an invalid line is rejected as a whole. The db and rp
+// parameters are kept in the headers of the record source, the openGemini
+// output writes to them with database_header and retention_policy_header.
+type Input struct {
+	listener.Config
+
+	*listener.Listener `toml:"-"`
+}
+
+func (i *Input) Name() string {
+	return "http_listener"
+}
+
+func (*Input) SampleConfig() string {
+	return sampleConfig
+}
+
+func (i *Input) Start(_ edge.Edge, out edge.Edge) error {
+	return i.Listener.Start(out)
+}
+
+func (i *Input) decode(r *http.Request, body []byte) (*edge.Record, error) {
+	q := r.URL.Query()
+	precision, ok := precisions[q.Get("precision")]
+	if !ok {
+		return nil, fmt.Errorf("invalid precision %q", q.Get("precision"))
+	}
+
+	now := time.Now()
+	points, err := models.ParsePointsWithPrecision(body, now, precision)
+	if err != nil {
+		return nil, err
+	}
+	payload := make([]byte, 0, len(body))
+	for j, pt := range points {
+		if j > 0 {
+			payload = append(payload, '\n')
+		}
+		payload = pt.AppendString(payload)
+	}
+
+	src := edge.Source{Timestamp: now}
+	for _, k := range []string{"db", "rp"} {
+		if v := q.Get(k); v != "" {
+			if src.Headers == nil {
+				src.Headers = make(map[string]string, 2)
+			}
+			src.Headers[k] = v
+		}
+	}
+	return &edge.Record{Payload: payload, Source: src}, nil
+}
+
+func init() {
+	inputs.Add("http_listener", func() node.Node {
+		i := &Input{Config: listener.NewConfig(defaultPath)}
+		i.Listener = listener.New(i.Name(), &i.Config, i.decode)
+		return i
+	})
+}
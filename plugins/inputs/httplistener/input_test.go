@@ -0,0 +1,126 @@
+/*
+Copyright 2022 Huawei Cloud Computing Technologies Co., Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package httplistener_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/openGemini/openGemini-forwarder/edge"
+	"github.com/openGemini/openGemini-forwarder/lib/logger"
+	"github.com/openGemini/openGemini-forwarder/plugins/inputs"
+	"github.com/openGemini/openGemini-forwarder/plugins/inputs/httplistener"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func init() {
+	logger.SetLogger(zap.NewNop())
+}
+
+func newInput(t *testing.T, configure func(i *httplistener.Input)) (*httplistener.Input, edge.Edge) {
+	i := inputs.GetInputs()["http_listener"]().(*httplistener.Input)
+	if configure != nil {
+		configure(i)
+	}
+	if err := i.Init(); err != nil {
+		t.Fatal(err)
+	}
+	out := edge.NewEdge("out", 1)
+	if err := i.Start(nil, out); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = i.Stop() })
+	return i, out
+}
+
+func write(h http.Handler, body []byte, query string, header http.Header) int {
+	r := httptest.NewRequest(http.MethodPost, "/write?"+query, bytes.NewReader(body))
+	for k, v := range header {
+		r.Header[k] = v
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w.Code
+}
+
+func TestInput(t *testing.T) {
+	i, out := newInput(t, nil)
+	assert.Equal(t, "/write", i.Pattern())
+
+	code := write(i, []byte("cpu,host=a usage=1 10\nmem free=2i 20"), "db=db0&rp=rp0&precision=s", nil)
+	if !assert.Equal(t, http.StatusNoContent, code) {
+		return
+	}
+	record := <-out.Out()
+	assert.Equal(t, "cpu,host=a usage=1 10000000000\nmem free=2i 20000000000", string(record.Payload))
+	assert.Equal(t, map[string]string{"db": "db0", "rp": "rp0"}, record.Source.Headers)
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	_, _ = zw.Write([]byte("cpu usage=2 30"))
+	_ = zw.Close()
+	code = write(i, gz.Bytes(), "", http.Header{"Content-Encoding": {"gzip"}})
+	if assert.Equal(t, http.StatusNoContent, code) {
+		assert.Equal(t, "cpu usage=2 30", string((<-out.Out()).Payload))
+	}
+
+	// the second request finds the edge full
+	assert.Equal(t, http.StatusNoContent, write(i, []byte("cpu usage=3 40"), "", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, write(i, []byte("cpu usage=4 50"), "", nil))
+	<-out.Out()
+
+	assert.Equal(t, http.StatusBadRequest, write(i, []byte("cpu usage="), "", nil))
+	assert.Equal(t, http.StatusBadRequest, write(i, []byte("cpu usage=1"), "precision=x", nil))
+
+	w := httptest.NewRecorder()
+	i.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/write", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+
+	assert.NoError(t, i.Stop())
+	assert.Error(t, i.Check())
+	assert.Equal(t, http.StatusServiceUnavailable, write(i, []byte("cpu usage=1"), "", nil))
+}
+
+func TestInputLimits(t *testing.T) {
+	i, _ := newInput(t, func(i *httplistener.Input) {
+		i.MaxBodySize = 16
+		i.BasicUsername, i.BasicPassword = "user", "secret"
+	})
+
+	assert.Equal(t, http.StatusUnauthorized, write(i, []byte("cpu usage=1"), "", nil))
+
+	r := httptest.NewRequest(http.MethodPost, "/write", nil)
+	r.SetBasicAuth("user", "secret")
+	auth := http.Header{"Authorization": r.Header["Authorization"]}
+	assert.Equal(t, http.StatusNoContent, write(i, []byte("cpu usage=1"), "", auth))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, write(i, []byte(strings.Repeat("cpu usage=1\n", 2)), "", auth))
+}
+
+func TestInputValidate(t *testing.T) {
+	i := inputs.GetInputs()["http_listener"]().(*httplistener.Input)
+	i.Path = "write"
+	assert.Error(t, i.Init())
+
+	i.Path = "/write"
+	i.TLSCert = "cert.pem"
+	assert.Error(t, i.Init())
+}
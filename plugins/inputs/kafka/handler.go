@@ -17,73 +17,170 @@ limitations under the License.
 package kafka
 
 import (
+	"context"
 	"fmt"
+	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/Shopify/sarama"
 	"github.com/openGemini/openGemini-forwarder/edge"
+	"github.com/openGemini/openGemini-forwarder/lib/deadletter"
 	"github.com/openGemini/openGemini-forwarder/lib/logger"
+	"github.com/openGemini/openGemini-forwarder/lib/metrics"
 	"github.com/openGemini/openGemini-forwarder/lib/pool"
+	"github.com/openGemini/openGemini-forwarder/plugins/inputs/delivery"
 	"go.uber.org/zap"
 )
 
-func NewConsumerGroupHandler(edge edge.Edge, log logger.Logger) *ConsumerGroupHandler {
+func NewConsumerGroupHandler(edge edge.Edge, log logger.Logger, maxUndelivered int) *ConsumerGroupHandler {
 	handler := &ConsumerGroupHandler{
-		log:  log,
-		edge: edge,
+		Node:        nodeName,
+		log:         log,
+		edge:        edge,
+		undelivered: make(chan struct{}, maxUndelivered),
 	}
 	return handler
 }
 
 // ConsumerGroupHandler is a sarama.ConsumerGroupHandler implementation.
 type ConsumerGroupHandler struct {
+	// Node is the name of the input in the metrics.
+	Node          string
 	MaxMessageLen int
 	TopicTag      string
-
-	edge edge.Edge
-	wg   sync.WaitGroup
-	mu   sync.Mutex
-
-	log             logger.Logger
-	kafkaRecordPool *pool.KafkaRecordPool
+	// MaxReplays is how many times a record that failed to be delivered is
+	// sent into the dag again, after that its offset is held and the
+	// partition is not committed past it until the session ends. Once
+	// maxUndelivered messages are pending behind a held offset, the
+	// partition is not fetched any more, the session has to be restarted
+	// to consume it again. Records failed with a permanent error are
+	// dropped without replay.
+	MaxReplays    int
+	ReplayBackoff time.Duration
+	// DeadLetter, if set, receives the messages that would be dropped or
+	// held, their offsets are then committed.
+	DeadLetter deadletter.Writer
+
+	edge   edge.Edge
+	paused <-chan struct{}
+	// joined is set to 1 while the session is open
+	joined *int32
+	wg     sync.WaitGroup
+	mu     sync.Mutex
+
+	// undelivered limits the records in the dag
+	undelivered chan struct{}
+	tracker     *offsetTracker
+	ctx         context.Context
+
+	log        logger.Logger
+	recordPool *pool.RecordPool
+	replayer   *delivery.Replayer
 }
 
 // Setup is called once when a new session is opened.  It setups up the handler
 // and begins processing delivered messages.
-func (h *ConsumerGroupHandler) Setup(sarama.ConsumerGroupSession) error {
-	h.kafkaRecordPool = pool.NewKafkaRecordPool()
+func (h *ConsumerGroupHandler) Setup(session sarama.ConsumerGroupSession) error {
+	h.recordPool = pool.NewRecordPool()
+	h.tracker = newOffsetTracker(session, cap(h.undelivered))
+	h.ctx = session.Context()
+	h.replayer = &delivery.Replayer{
+		Node:          h.Node,
+		Out:           h.edge,
+		MaxReplays:    h.MaxReplays,
+		ReplayBackoff: h.ReplayBackoff,
+		DeadLetter:    h.DeadLetter,
+		Held:          "deliver record fail, hold offset and stop fetching the partition",
+		Log:           &h.log,
+	}
+	if h.joined != nil {
+		atomic.StoreInt32(h.joined, 1)
+	}
 	return nil
 }
 
 // Handle processes a message and if successful saves it to be acknowledged
 // after delivery.
 func (h *ConsumerGroupHandler) Handle(session sarama.ConsumerGroupSession, msg *sarama.ConsumerMessage) error {
+	src := edge.Source{Topic: msg.Topic, Partition: msg.Partition, Offset: msg.Offset, Timestamp: msg.Timestamp}
+	if !h.tracker.add(src) {
+		return nil
+	}
 	if h.MaxMessageLen != 0 && len(msg.Value) > h.MaxMessageLen {
-		session.MarkMessage(msg, "")
-		return fmt.Errorf("message exceeds max_message_len (actual %d, max %d)",
+		err := fmt.Errorf("message exceeds max_message_len (actual %d, max %d)",
 			len(msg.Value), h.MaxMessageLen)
+		if !h.replayer.WriteDeadLetter(&edge.Record{Payload: msg.Value, Source: src}, edge.WithStage(nodeName, err), fields(src)...) {
+			metrics.NodeRecords.WithLabelValues(h.Node, metrics.Dropped).Inc()
+		}
+		h.tracker.delivered(src)
+		return err
+	}
+
+	select {
+	case h.undelivered <- struct{}{}:
+	case <-h.ctx.Done():
+		return nil
+	}
+
+	if len(msg.Headers) > 0 {
+		src.Headers = make(map[string]string, len(msg.Headers))
+		for _, header := range msg.Headers {
+			src.Headers[string(header.Key)] = string(header.Value)
+		}
 	}
 
-	kafkaRecordPool := h.kafkaRecordPool.Get()
-	kafkaRecordPool.Message = msg
-	kafkaRecordPool.Session = session
-	h.edge.In() <- kafkaRecordPool
+	record := h.recordPool.Get()
+	record.Payload = msg.Value
+	record.Source = src
+	record.Done = h.onDone
+	record.Attempts = 1
+	h.wg.Add(1)
+	select {
+	case h.edge.In() <- record:
+		metrics.NodeRecords.WithLabelValues(h.Node, metrics.Out).Inc()
+	case <-h.ctx.Done():
+		h.release(record)
+	}
 	return nil
 }
 
+func (h *ConsumerGroupHandler) onDone(record *edge.Record, err error) {
+	src := record.Source
+	h.replayer.Done(h.ctx, record, err, func() { h.tracker.delivered(src) }, func() { h.release(record) },
+		fields(src)...)
+}
+
+func fields(src edge.Source) []zap.Field {
+	return []zap.Field{zap.String("topic", src.Topic), zap.Int32("partition", src.Partition), zap.Int64("offset", src.Offset)}
+}
+
+func (h *ConsumerGroupHandler) release(record *edge.Record) {
+	h.recordPool.Put(record)
+	<-h.undelivered
+	h.wg.Done()
+}
+
 // ConsumeClaim is called once each claim in a goroutine and must be
 // thread-safe.  Should run until the claim is closed.
 func (h *ConsumerGroupHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
 	ctx := session.Context()
+	lag := metrics.KafkaLag.WithLabelValues(claim.Topic(), strconv.FormatInt(int64(claim.Partition()), 10))
 
 	for {
 		select {
 		case <-ctx.Done():
 			return nil
+		case <-h.paused:
+			// leave the remaining messages unmarked until the session ends
+			<-ctx.Done()
+			return nil
 		case msg, ok := <-claim.Messages():
 			if !ok {
 				return nil
 			}
+			lag.Set(float64(claim.HighWaterMarkOffset() - msg.Offset - 1))
 			err := h.Handle(session, msg)
 			if err != nil {
 				h.log.Error("handle msg fail", zap.Error(err))
@@ -92,9 +189,23 @@ func (h *ConsumerGroupHandler) ConsumeClaim(session sarama.ConsumerGroupSession,
 	}
 }
 
-// Cleanup stops the internal goroutine and is called after all ConsumeClaim
-// functions have completed.
+// Cleanup waits for the records in the dag to be delivered, so that their
+// offsets are committed when the session ends, and is called after all
+// ConsumeClaim functions have completed.
 func (h *ConsumerGroupHandler) Cleanup(sarama.ConsumerGroupSession) error {
-	h.wg.Wait()
+	if h.joined != nil {
+		atomic.StoreInt32(h.joined, 0)
+	}
+	done := make(chan struct{})
+	go func() {
+		h.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(cleanupTimeout):
+		h.log.Warn("records are still in flight at the end of the session, their offsets are not committed")
+	}
 	return nil
 }
@@ -19,41 +19,54 @@ package kafka
 import (
 	"context"
 	_ "embed"
+	"errors"
 	"fmt"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Shopify/sarama"
+	itoml "github.com/influxdata/influxdb/toml"
 	"github.com/influxdata/telegraf/plugins/common/kafka"
 	"github.com/openGemini/openGemini-forwarder/dag/node"
 	"github.com/openGemini/openGemini-forwarder/edge"
 	kafkalogger "github.com/openGemini/openGemini-forwarder/lib/adaptor/telegraf/logger"
+	"github.com/openGemini/openGemini-forwarder/lib/deadletter"
 	"github.com/openGemini/openGemini-forwarder/lib/logger"
 	"github.com/openGemini/openGemini-forwarder/plugins/inputs"
+	"github.com/openGemini/openGemini-forwarder/plugins/inputs/delivery"
 )
 
+//go:embed sample.conf
 var sampleConfig string
 
 const (
+	nodeName = "kafka_consumer"
+
 	defaultMaxUndeliveredMessages = 1000
 	defaultMaxProcessingTime      = time.Duration(100 * time.Millisecond)
 	defaultConsumerGroup          = "telegraf_metrics_consumers"
 	reconnectDelay                = 5 * time.Second
+	cleanupTimeout                = 10 * time.Second
 )
 
 type Input struct {
-	Brokers                []string      `toml:"brokers"`
-	ConsumerGroup          string        `toml:"consumer_group"`
-	MaxMessageLen          int           `toml:"max_message_len"`
-	MaxUndeliveredMessages int           `toml:"max_undelivered_messages"`
-	MaxProcessingTime      time.Duration `toml:"max_processing_time"`
-	Offset                 string        `toml:"offset"`
-	BalanceStrategy        string        `toml:"balance_strategy"`
-	Topics                 []string      `toml:"topics"`
-	TopicTag               string        `toml:"topic_tag"`
-	ConsumerFetchDefault   int64         `toml:"consumer_fetch_default"`
-	ConnectionStrategy     string        `toml:"connection_strategy"`
+	node.Alias
+
+	Brokers                []string       `toml:"brokers"`
+	ConsumerGroup          string         `toml:"consumer_group"`
+	MaxMessageLen          int            `toml:"max_message_len"`
+	MaxUndeliveredMessages int            `toml:"max_undelivered_messages"`
+	MaxProcessingTime      time.Duration  `toml:"max_processing_time"`
+	Offset                 string         `toml:"offset"`
+	BalanceStrategy        string         `toml:"balance_strategy"`
+	Topics                 []string       `toml:"topics"`
+	TopicTag               string         `toml:"topic_tag"`
+	ConsumerFetchDefault   int64          `toml:"consumer_fetch_default"`
+	ConnectionStrategy     string         `toml:"connection_strategy"`
+	MaxReplays             int            `toml:"max_replays"`
+	ReplayBackoff          itoml.Duration `toml:"replay_backoff"`
 
 	kafka.ReadConfig
 
@@ -66,10 +79,21 @@ type Input struct {
 
 	wg     sync.WaitGroup
 	cancel context.CancelFunc
+
+	paused    chan struct{}
+	pauseOnce sync.Once
+
+	deadLetter deadletter.Writer
+	// joined is 1 while a consumer group session is open
+	joined int32
 }
 
 func (k *Input) Name() string {
-	return "kafka_consumer"
+	return nodeName
+}
+
+func (*Input) SampleConfig() string {
+	return sampleConfig
 }
 
 type ConsumerGroup interface {
@@ -88,8 +112,38 @@ func (*SaramaCreator) Create(brokers []string, group string, cfg *sarama.Config)
 	return sarama.NewConsumerGroup(brokers, group, cfg)
 }
 
+// Validate validates that the configuration is acceptable.
+func (k *Input) Validate() error {
+	if k.MaxReplays < 0 {
+		return fmt.Errorf("invalid max_replays %d", k.MaxReplays)
+	}
+
+	switch strings.ToLower(k.Offset) {
+	case "oldest", "newest", "":
+	default:
+		return fmt.Errorf("invalid offset %q", k.Offset)
+	}
+
+	switch strings.ToLower(k.BalanceStrategy) {
+	case "range", "roundrobin", "sticky", "":
+	default:
+		return fmt.Errorf("invalid balance strategy %q", k.BalanceStrategy)
+	}
+
+	switch strings.ToLower(k.ConnectionStrategy) {
+	case "defer", "startup", "":
+	default:
+		return fmt.Errorf("invalid connection strategy %q", k.ConnectionStrategy)
+	}
+	return nil
+}
+
 func (k *Input) Init() error {
+	if err := k.Validate(); err != nil {
+		return err
+	}
 	k.SetLogger()
+	k.Log = *logger.NewLogger(k.Name())
 
 	if k.MaxUndeliveredMessages == 0 {
 		k.MaxUndeliveredMessages = defaultMaxUndeliveredMessages
@@ -100,6 +154,9 @@ func (k *Input) Init() error {
 	if k.ConsumerGroup == "" {
 		k.ConsumerGroup = defaultConsumerGroup
 	}
+	if k.ReplayBackoff == 0 {
+		k.ReplayBackoff = itoml.Duration(delivery.DefaultReplayBackoff)
+	}
 
 	cfg := sarama.NewConfig()
 
@@ -111,23 +168,19 @@ func (k *Input) Init() error {
 	}
 
 	switch strings.ToLower(k.Offset) {
-	case "oldest", "":
-		cfg.Consumer.Offsets.Initial = sarama.OffsetOldest
 	case "newest":
 		cfg.Consumer.Offsets.Initial = sarama.OffsetNewest
 	default:
-		return fmt.Errorf("invalid offset %q", k.Offset)
+		cfg.Consumer.Offsets.Initial = sarama.OffsetOldest
 	}
 
 	switch strings.ToLower(k.BalanceStrategy) {
-	case "range", "":
-		cfg.Consumer.Group.Rebalance.GroupStrategies = []sarama.BalanceStrategy{sarama.BalanceStrategyRange}
 	case "roundrobin":
 		cfg.Consumer.Group.Rebalance.GroupStrategies = []sarama.BalanceStrategy{sarama.BalanceStrategyRoundRobin}
 	case "sticky":
 		cfg.Consumer.Group.Rebalance.GroupStrategies = []sarama.BalanceStrategy{sarama.BalanceStrategySticky}
 	default:
-		return fmt.Errorf("invalid balance strategy %q", k.BalanceStrategy)
+		cfg.Consumer.Group.Rebalance.GroupStrategies = []sarama.BalanceStrategy{sarama.BalanceStrategyRange}
 	}
 
 	if k.ConsumerCreator == nil {
@@ -140,12 +193,6 @@ func (k *Input) Init() error {
 		cfg.Consumer.Fetch.Default = int32(k.ConsumerFetchDefault)
 	}
 
-	switch strings.ToLower(k.ConnectionStrategy) {
-	default:
-		return fmt.Errorf("invalid connection strategy %q", k.ConnectionStrategy)
-	case "defer", "startup", "":
-	}
-
 	k.config = cfg
 	return nil
 }
@@ -162,10 +209,11 @@ func (k *Input) create() error {
 }
 
 func (k *Input) startErrorAdder() {
+	errs := k.consumer.Errors()
 	k.wg.Add(1)
 	go func() {
 		defer k.wg.Done()
-		for err := range k.consumer.Errors() {
+		for err := range errs {
 			k.Log.Error(fmt.Sprintf("channel: %v", err))
 		}
 	}()
@@ -176,6 +224,9 @@ func (k *Input) Start(_ edge.Edge, out edge.Edge) error {
 
 	ctx, cancel := context.WithCancel(context.Background())
 	k.cancel = cancel
+	// a stopped input is paused, it is started again unpaused
+	k.paused = make(chan struct{})
+	k.pauseOnce = sync.Once{}
 
 	if k.ConnectionStrategy != "defer" {
 		err = k.create()
@@ -194,17 +245,22 @@ func (k *Input) Start(_ edge.Edge, out edge.Edge) error {
 		if k.consumer == nil {
 			err = k.create()
 			if err != nil {
-				k.Log.Error(fmt.Sprintf("create consumer async: %w", err))
+				k.Log.Error(fmt.Sprintf("create consumer async: %v", err))
 				return
 			}
+			k.startErrorAdder()
 		}
 
-		k.startErrorAdder()
-
 		for ctx.Err() == nil {
-			handler := NewConsumerGroupHandler(out, k.Log)
+			handler := NewConsumerGroupHandler(out, k.Log, k.MaxUndeliveredMessages)
+			handler.paused = k.paused
 			handler.MaxMessageLen = k.MaxMessageLen
+			handler.Node = k.AliasOr(nodeName)
+			handler.MaxReplays = k.MaxReplays
+			handler.ReplayBackoff = time.Duration(k.ReplayBackoff)
 			handler.TopicTag = k.TopicTag
+			handler.DeadLetter = k.deadLetter
+			handler.joined = &k.joined
 			err := k.consumer.Consume(ctx, k.Topics, handler)
 			if err != nil {
 				k.Log.Error(fmt.Sprintf("consume: %v", err))
@@ -216,13 +272,38 @@ func (k *Input) Start(_ edge.Edge, out edge.Edge) error {
 		}
 		err = k.consumer.Close()
 		if err != nil {
-			k.Log.Error(fmt.Sprintf("close: %w", err))
+			k.Log.Error(fmt.Sprintf("close: %v", err))
 		}
+		k.consumer = nil
 	}()
 
 	return nil
 }
 
+// SetDeadLetter makes the input write the messages that fail for good to w
+// instead of dropping them or holding their offset.
+func (k *Input) SetDeadLetter(w deadletter.Writer) {
+	k.deadLetter = w
+}
+
+// Check reports whether the consumer joined its group.
+func (k *Input) Check() error {
+	if atomic.LoadInt32(&k.joined) == 0 {
+		return errors.New("consumer group not joined")
+	}
+	return nil
+}
+
+// Pause stops handing messages to the dag but keeps the consumer group
+// session, so the offsets of the records in flight can still be marked and
+// are committed by Stop.
+func (k *Input) Pause() error {
+	k.pauseOnce.Do(func() {
+		close(k.paused)
+	})
+	return nil
+}
+
 func (k *Input) Stop() error {
 	k.cancel()
 	k.wg.Wait()
@@ -230,7 +311,7 @@ func (k *Input) Stop() error {
 }
 
 func init() {
-	inputs.Add("kafka_consumer", func() node.Node {
-		return &Input{}
+	inputs.Add(nodeName, func() node.Node {
+		return &Input{MaxReplays: delivery.DefaultMaxReplays}
 	})
 }
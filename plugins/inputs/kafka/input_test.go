@@ -0,0 +1,83 @@
+/*
+Copyright 2022 Huawei Cloud Computing Technologies Co., Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kafka
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/openGemini/openGemini-forwarder/edge"
+	"github.com/openGemini/openGemini-forwarder/lib/logger"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func init() {
+	logger.SetLogger(zap.NewNop())
+}
+
+// fakeGroup hands the handler of every Consume call to handlers and blocks
+// until the session is cancelled.
+type fakeGroup struct {
+	handlers chan sarama.ConsumerGroupHandler
+	errs     chan error
+}
+
+func (g *fakeGroup) Consume(ctx context.Context, _ []string, handler sarama.ConsumerGroupHandler) error {
+	g.handlers <- handler
+	<-ctx.Done()
+	return nil
+}
+
+func (g *fakeGroup) Errors() <-chan error { return g.errs }
+
+func (g *fakeGroup) Close() error {
+	close(g.errs)
+	return nil
+}
+
+type fakeCreator struct {
+	handlers chan sarama.ConsumerGroupHandler
+}
+
+func (c *fakeCreator) Create([]string, string, *sarama.Config) (ConsumerGroup, error) {
+	return &fakeGroup{handlers: c.handlers, errs: make(chan error)}, nil
+}
+
+func TestInputRestart(t *testing.T) {
+	creator := &fakeCreator{handlers: make(chan sarama.ConsumerGroupHandler, 1)}
+	k := &Input{Brokers: []string{"127.0.0.1:9092"}, Topics: []string{"t"}, ConsumerCreator: creator}
+	if !assert.NoError(t, k.Init()) {
+		return
+	}
+	out := edge.NewEdge("test", 1)
+
+	for i := 0; i < 2; i++ {
+		if !assert.NoError(t, k.Start(nil, out)) {
+			return
+		}
+		h := (<-creator.handlers).(*ConsumerGroupHandler)
+		select {
+		case <-h.paused:
+			t.Fatal("input is paused after start")
+		default:
+		}
+		assert.NoError(t, k.Pause())
+		assert.NoError(t, k.Stop())
+	}
+}
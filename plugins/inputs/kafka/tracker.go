@@ -0,0 +1,120 @@
+/*
+Copyright 2022 Huawei Cloud Computing Technologies Co., Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kafka
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/Shopify/sarama"
+	"github.com/openGemini/openGemini-forwarder/edge"
+)
+
+type topicPartition struct {
+	topic     string
+	partition int32
+}
+
+type pendingOffset struct {
+	offset    int64
+	delivered bool
+}
+
+// offsetTracker marks the offset of a partition only when every message
+// consumed before it has been delivered, so that a message that is still in
+// flight or failed is consumed again after a restart.
+type offsetTracker struct {
+	session sarama.ConsumerGroupSession
+	// limit bounds the offsets pending per partition, so that a failed
+	// message whose offset is held stops the fetching of its partition
+	// instead of piling up the messages behind it.
+	limit int
+
+	mu         sync.Mutex
+	partitions map[topicPartition][]pendingOffset
+	// trimmed is closed when offsets of a full partition are marked.
+	trimmed map[topicPartition]chan struct{}
+}
+
+func newOffsetTracker(session sarama.ConsumerGroupSession, limit int) *offsetTracker {
+	return &offsetTracker{
+		session:    session,
+		limit:      limit,
+		partitions: make(map[topicPartition][]pendingOffset),
+		trimmed:    make(map[topicPartition]chan struct{}),
+	}
+}
+
+// add registers a consumed message, messages of a partition are added in
+// offset order. It waits while the partition is full and returns false if
+// the session ends meanwhile.
+func (t *offsetTracker) add(src edge.Source) bool {
+	tp := topicPartition{topic: src.Topic, partition: src.Partition}
+
+	for {
+		t.mu.Lock()
+		if t.limit <= 0 || len(t.partitions[tp]) < t.limit {
+			t.partitions[tp] = append(t.partitions[tp], pendingOffset{offset: src.Offset})
+			t.mu.Unlock()
+			return true
+		}
+		trimmed, ok := t.trimmed[tp]
+		if !ok {
+			trimmed = make(chan struct{})
+			t.trimmed[tp] = trimmed
+		}
+		t.mu.Unlock()
+
+		select {
+		case <-trimmed:
+		case <-t.session.Context().Done():
+			return false
+		}
+	}
+}
+
+// delivered records that the message was delivered and marks the offset of
+// the partition up to the first message that is not.
+func (t *offsetTracker) delivered(src edge.Source) {
+	tp := topicPartition{topic: src.Topic, partition: src.Partition}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	pending := t.partitions[tp]
+	i := sort.Search(len(pending), func(i int) bool {
+		return pending[i].offset >= src.Offset
+	})
+	if i == len(pending) || pending[i].offset != src.Offset {
+		return
+	}
+	pending[i].delivered = true
+
+	n := 0
+	for n < len(pending) && pending[n].delivered {
+		n++
+	}
+	if n == 0 {
+		return
+	}
+	t.session.MarkOffset(tp.topic, tp.partition, pending[n-1].offset+1, "")
+	t.partitions[tp] = pending[n:]
+	if trimmed, ok := t.trimmed[tp]; ok {
+		close(trimmed)
+		delete(t.trimmed, tp)
+	}
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2022 Huawei Cloud Computing Technologies Co., Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kafka
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/openGemini/openGemini-forwarder/edge"
+	"github.com/stretchr/testify/assert"
+)
+
+type markSession struct {
+	sarama.ConsumerGroupSession
+	ctx    context.Context
+	marked map[int32]int64
+}
+
+func (s *markSession) Context() context.Context {
+	return s.ctx
+}
+
+func (s *markSession) MarkOffset(_ string, partition int32, offset int64, _ string) {
+	s.marked[partition] = offset
+}
+
+func TestOffsetTracker(t *testing.T) {
+	session := &markSession{marked: map[int32]int64{}}
+	tracker := newOffsetTracker(session, 0)
+
+	var msgs []edge.Source
+	for i := int64(0); i < 4; i++ {
+		msg := edge.Source{Topic: "t", Partition: 0, Offset: 10 + i}
+		msgs = append(msgs, msg)
+		tracker.add(msg)
+	}
+	other := edge.Source{Topic: "t", Partition: 1, Offset: 3}
+	tracker.add(other)
+
+	tracker.delivered(msgs[1])
+	tracker.delivered(msgs[3])
+	assert.Empty(t, session.marked)
+
+	tracker.delivered(other)
+	assert.Equal(t, int64(4), session.marked[1])
+
+	tracker.delivered(msgs[0])
+	assert.Equal(t, int64(12), session.marked[0])
+
+	tracker.delivered(msgs[2])
+	assert.Equal(t, int64(14), session.marked[0])
+}
+
+func TestOffsetTrackerLimit(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	session := &markSession{ctx: ctx, marked: map[int32]int64{}}
+	tracker := newOffsetTracker(session, 2)
+
+	held := edge.Source{Topic: "t", Offset: 0}
+	assert.True(t, tracker.add(held))
+	assert.True(t, tracker.add(edge.Source{Topic: "t", Offset: 1}))
+	// other partitions are not stopped by a full one
+	assert.True(t, tracker.add(edge.Source{Topic: "t", Partition: 1}))
+
+	added := make(chan bool)
+	go func() {
+		added <- tracker.add(edge.Source{Topic: "t", Offset: 2})
+	}()
+	select {
+	case <-added:
+		t.Fatal("full partition is not blocked")
+	case <-time.After(10 * time.Millisecond):
+	}
+	tracker.delivered(held)
+	assert.True(t, <-added)
+
+	go func() {
+		added <- tracker.add(edge.Source{Topic: "t", Offset: 3})
+	}()
+	cancel()
+	assert.False(t, <-added)
+}
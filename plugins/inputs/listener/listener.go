@@ -0,0 +1,307 @@
+/*
+Copyright 2022 Huawei Cloud Computing Technologies Co., Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package listener
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	itoml "github.com/influxdata/influxdb/toml"
+	"github.com/influxdata/telegraf/plugins/common/tls"
+	"github.com/openGemini/openGemini-forwarder/dag/node"
+	"github.com/openGemini/openGemini-forwarder/edge"
+	"github.com/openGemini/openGemini-forwarder/lib/deadletter"
+	"github.com/openGemini/openGemini-forwarder/lib/logger"
+	"github.com/openGemini/openGemini-forwarder/lib/metrics"
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultMaxBodySize  = 32 * 1024 * 1024
+	DefaultReadTimeout  = 10 * time.Second
+	DefaultWriteTimeout = 10 * time.Second
+
+	shutdownTimeout = 5 * time.Second
+)
+
+// Config is the part of the config of the inputs receiving http requests
+// that tells how they are served.
+type Config struct {
+	// ServiceAddress is the address of the listener of the input, the
+	// requests are served on the forwarder listener if it is empty.
+	ServiceAddress string `toml:"service_address"`
+	Path           string `toml:"path"`
+	// MaxBodySize bounds the body of a request, once decompressed.
+	MaxBodySize  itoml.Size     `toml:"max_body_size"`
+	ReadTimeout  itoml.Duration `toml:"read_timeout"`
+	WriteTimeout itoml.Duration `toml:"write_timeout"`
+
+	BasicUsername string `toml:"basic_username"`
+	BasicPassword string `toml:"basic_password"`
+
+	// tls of the listener of the input
+	tls.ServerConfig
+}
+
+// NewConfig returns the default config of an input served on path.
+func NewConfig(path string) Config {
+	return Config{
+		Path:         path,
+		MaxBodySize:  itoml.Size(DefaultMaxBodySize),
+		ReadTimeout:  itoml.Duration(DefaultReadTimeout),
+		WriteTimeout: itoml.Duration(DefaultWriteTimeout),
+	}
+}
+
+// Validate validates that the configuration is acceptable.
+func (c *Config) Validate() error {
+	if !strings.HasPrefix(c.Path, "/") {
+		return fmt.Errorf("invalid path %q", c.Path)
+	}
+	if c.ServiceAddress == "" && (c.TLSCert != "" || c.TLSKey != "") {
+		return errors.New("tls_cert and tls_key require service_address")
+	}
+	if _, err := c.ServerConfig.TLSConfig(); err != nil {
+		return fmt.Errorf("tls config: %v", err)
+	}
+	return nil
+}
+
+// DecodeFunc returns the record of the body of r, nil if there is nothing
+// to emit, or an error answered as a bad request.
+type DecodeFunc func(r *http.Request, body []byte) (*edge.Record, error)
+
+// Listener serves the requests of an input. It checks their method, basic
+// auth and body size, decompresses a gzip body and emits the record the
+// input decodes from it. A request is answered 204 once its record is on
+// the edge, or 503 if the edge is full or the input is stopped. The records
+// nacked downstream are written to the dead letter, if any, or dropped.
+type Listener struct {
+	node.Alias
+
+	name   string
+	config *Config
+	decode DecodeFunc
+	log    *logger.Logger
+
+	server *http.Server
+
+	mu         sync.RWMutex
+	out        edge.Edge
+	deadLetter deadletter.Writer
+}
+
+// New returns the listener of the input name, config is decoded later.
+func New(name string, config *Config, decode DecodeFunc) *Listener {
+	return &Listener{name: name, config: config, decode: decode}
+}
+
+func (l *Listener) Init() error {
+	if err := l.config.Validate(); err != nil {
+		return err
+	}
+	l.log = logger.NewLogger(l.name)
+	return nil
+}
+
+// Pattern implements node.Handler.
+func (l *Listener) Pattern() string {
+	if l.config.ServiceAddress != "" {
+		return ""
+	}
+	return l.config.Path
+}
+
+// SetDeadLetter implements deadletter.User.
+func (l *Listener) SetDeadLetter(w deadletter.Writer) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.deadLetter = w
+}
+
+// Start emits the records to out, and listens on the service address if
+// there is one.
+func (l *Listener) Start(out edge.Edge) error {
+	if l.config.ServiceAddress != "" {
+		tlsConfig, err := l.config.ServerConfig.TLSConfig()
+		if err != nil {
+			return err
+		}
+		ln, err := net.Listen("tcp", l.config.ServiceAddress)
+		if err != nil {
+			return err
+		}
+		mux := http.NewServeMux()
+		mux.Handle(l.config.Path, l)
+		l.server = &http.Server{
+			Handler:      mux,
+			ReadTimeout:  time.Duration(l.config.ReadTimeout),
+			WriteTimeout: time.Duration(l.config.WriteTimeout),
+			TLSConfig:    tlsConfig,
+		}
+		go func(server *http.Server) {
+			var err error
+			if tlsConfig != nil {
+				err = server.ServeTLS(ln, "", "")
+			} else {
+				err = server.Serve(ln)
+			}
+			if err != nil && err != http.ErrServerClosed {
+				l.log.Error("serve http failed", zap.String("addr", ln.Addr().String()), zap.Error(err))
+			}
+		}(l.server)
+	}
+
+	l.mu.Lock()
+	l.out = out
+	l.mu.Unlock()
+	return nil
+}
+
+// Stop answers 503 to the next requests, once the requests in progress
+// have emitted their record, and closes the listener of the input.
+func (l *Listener) Stop() error {
+	l.mu.Lock()
+	l.out = nil
+	l.mu.Unlock()
+
+	if l.server == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	err := l.server.Shutdown(ctx)
+	l.server = nil
+	return err
+}
+
+// Check reports whether the listener accepts requests.
+func (l *Listener) Check() error {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.out == nil {
+		return errors.New("not started")
+	}
+	return nil
+}
+
+func (l *Listener) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !l.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="`+l.name+`"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	body, status, err := l.readBody(r)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	record, err := l.decode(r, body)
+	if err != nil {
+		metrics.NodeRecords.WithLabelValues(l.AliasOr(l.name), metrics.Dropped).Inc()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if record == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	record.Done = l.onDone
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.out == nil {
+		http.Error(w, "input is stopped", http.StatusServiceUnavailable)
+		return
+	}
+	select {
+	case l.out.In() <- record:
+		metrics.NodeRecords.WithLabelValues(l.AliasOr(l.name), metrics.Out).Inc()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "pipeline is full, retry later", http.StatusServiceUnavailable)
+	}
+}
+
+func (l *Listener) authorized(r *http.Request) bool {
+	if l.config.BasicUsername == "" && l.config.BasicPassword == "" {
+		return true
+	}
+	username, password, ok := r.BasicAuth()
+	return ok &&
+		subtle.ConstantTimeCompare([]byte(username), []byte(l.config.BasicUsername)) == 1 &&
+		subtle.ConstantTimeCompare([]byte(password), []byte(l.config.BasicPassword)) == 1
+}
+
+// readBody returns the body of r, decompressed, and the status answered if
+// it cannot be read.
+func (l *Listener) readBody(r *http.Request) ([]byte, int, error) {
+	limit := int64(l.config.MaxBodySize)
+	if r.ContentLength > limit {
+		return nil, http.StatusRequestEntityTooLarge, errors.New("request body too large")
+	}
+	var body io.Reader = io.LimitReader(r.Body, limit+1)
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, http.StatusBadRequest, fmt.Errorf("gzip: %v", err)
+		}
+		defer gz.Close()
+		body = io.LimitReader(gz, limit+1)
+	}
+	b, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	if int64(len(b)) > limit {
+		return nil, http.StatusRequestEntityTooLarge, errors.New("request body too large")
+	}
+	return b, 0, nil
+}
+
+// onDone writes the record nacked downstream to the dead letter.
+func (l *Listener) onDone(record *edge.Record, err error) {
+	if err == nil {
+		return
+	}
+	l.mu.RLock()
+	w := l.deadLetter
+	l.mu.RUnlock()
+	if w != nil {
+		if werr := w.Write(deadletter.NewItem(record, err)); werr == nil {
+			return
+		}
+	}
+	metrics.NodeRecords.WithLabelValues(l.AliasOr(l.name), metrics.Dropped).Inc()
+	l.log.Error("drop request", zap.Error(err))
+}
@@ -0,0 +1,425 @@
+/*
+Copyright 2022 Huawei Cloud Computing Technologies Co., Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mqtt
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	itoml "github.com/influxdata/influxdb/toml"
+	"github.com/influxdata/telegraf/plugins/common/tls"
+	"github.com/openGemini/openGemini-forwarder/dag/node"
+	"github.com/openGemini/openGemini-forwarder/edge"
+	"github.com/openGemini/openGemini-forwarder/lib/deadletter"
+	"github.com/openGemini/openGemini-forwarder/lib/logger"
+	"github.com/openGemini/openGemini-forwarder/lib/metrics"
+	"github.com/openGemini/openGemini-forwarder/plugins/inputs"
+	"github.com/openGemini/openGemini-forwarder/plugins/inputs/delivery"
+	"go.uber.org/zap"
+)
+
+//go:embed sample.conf
+var sampleConfig string
+
+const (
+	nodeName = "mqtt_consumer"
+
+	defaultConnectionTimeout      = 30 * time.Second
+	defaultMaxUndeliveredMessages = 1000
+	disconnectQuiesce             = 250
+	cleanupTimeout                = 10 * time.Second
+)
+
+// Client is the part of the paho client the input uses.
+type Client interface {
+	Connect() paho.Token
+	SubscribeMultiple(filters map[string]byte, callback paho.MessageHandler) paho.Token
+	IsConnectionOpen() bool
+	Disconnect(quiesce uint)
+}
+
+type ClientCreator interface {
+	Create(opts *paho.ClientOptions) Client
+}
+
+type PahoCreator struct{}
+
+func (*PahoCreator) Create(opts *paho.ClientOptions) Client {
+	return paho.NewClient(opts)
+}
+
+// TopicParsing tags the points of the messages whose topic matches Topic
+// with its segments.
+type TopicParsing struct {
+	// Topic is a topic filter, + matches any segment.
+	Topic string `toml:"topic"`
+	// Tags names the tag of each segment of the topic, _ skips a segment.
+	Tags string `toml:"tags"`
+
+	topic []string
+	tags  []string
+}
+
+func (p *TopicParsing) match(segments []string) bool {
+	if len(segments) != len(p.topic) {
+		return false
+	}
+	for i, s := range p.topic {
+		if s != "+" && s != segments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Input emits the messages of the topics it subscribes to. The messages
+// are acked once the outputs confirm their records, in the order they were
+// received, the broker delivers the others again in the next session of a
+// persistent session.
+type Input struct {
+	node.Alias
+
+	Servers                []string       `toml:"servers"`
+	Topics                 []string       `toml:"topics"`
+	QoS                    int            `toml:"qos"`
+	ClientID               string         `toml:"client_id"`
+	PersistentSession      bool           `toml:"persistent_session"`
+	Username               string         `toml:"username"`
+	Password               string         `toml:"password"`
+	ConnectionTimeout      itoml.Duration `toml:"connection_timeout"`
+	TopicTag               string         `toml:"topic_tag"`
+	TopicParsing           []TopicParsing `toml:"topic_parsing"`
+	MaxUndeliveredMessages int            `toml:"max_undelivered_messages"`
+	MaxReplays             int            `toml:"max_replays"`
+	ReplayBackoff          itoml.Duration `toml:"replay_backoff"`
+
+	tls.ClientConfig
+
+	ClientCreator ClientCreator `toml:"-"`
+
+	log      *logger.Logger
+	opts     *paho.ClientOptions
+	client   Client
+	out      edge.Edge
+	replayer delivery.Replayer
+
+	// ctx is cancelled by Stop, the context of the receiving by Pause
+	ctx        context.Context
+	cancel     context.CancelFunc
+	readCtx    context.Context
+	readCancel context.CancelFunc
+	inflight   sync.WaitGroup
+
+	mu      sync.Mutex
+	tracker *ackTracker
+}
+
+func (i *Input) Name() string {
+	return nodeName
+}
+
+func (*Input) SampleConfig() string {
+	return sampleConfig
+}
+
+// Validate validates that the configuration is acceptable.
+func (i *Input) Validate() error {
+	if len(i.Servers) == 0 {
+		return errors.New("no servers")
+	}
+	if len(i.Topics) == 0 {
+		return errors.New("no topics")
+	}
+	if i.QoS < 0 || i.QoS > 2 {
+		return fmt.Errorf("invalid qos %d, must be 0, 1 or 2", i.QoS)
+	}
+	if i.PersistentSession && i.ClientID == "" {
+		return errors.New("persistent_session requires client_id")
+	}
+	if i.MaxReplays < 0 {
+		return fmt.Errorf("invalid max_replays %d", i.MaxReplays)
+	}
+	for _, p := range i.TopicParsing {
+		topic := strings.Split(p.Topic, "/")
+		for _, s := range topic {
+			if s == "#" {
+				return fmt.Errorf("topic_parsing topic %q: only + wildcards are supported", p.Topic)
+			}
+		}
+		if len(strings.Split(p.Tags, "/")) != len(topic) {
+			return fmt.Errorf("topic_parsing topic %q: tags %q do not have as many segments", p.Topic, p.Tags)
+		}
+	}
+	if _, err := i.ClientConfig.TLSConfig(); err != nil {
+		return fmt.Errorf("tls config: %v", err)
+	}
+	return nil
+}
+
+func (i *Input) Init() error {
+	if err := i.Validate(); err != nil {
+		return err
+	}
+	i.log = logger.NewLogger(i.Name())
+
+	if i.ConnectionTimeout == 0 {
+		i.ConnectionTimeout = itoml.Duration(defaultConnectionTimeout)
+	}
+	if i.MaxUndeliveredMessages == 0 {
+		i.MaxUndeliveredMessages = defaultMaxUndeliveredMessages
+	}
+	if i.ReplayBackoff == 0 {
+		i.ReplayBackoff = itoml.Duration(delivery.DefaultReplayBackoff)
+	}
+	for j := range i.TopicParsing {
+		p := &i.TopicParsing[j]
+		p.topic = strings.Split(p.Topic, "/")
+		p.tags = strings.Split(p.Tags, "/")
+	}
+	if i.ClientCreator == nil {
+		i.ClientCreator = &PahoCreator{}
+	}
+
+	opts, err := i.clientOptions()
+	if err != nil {
+		return err
+	}
+	i.opts = opts
+	return nil
+}
+
+func (i *Input) clientOptions() (*paho.ClientOptions, error) {
+	tlsConfig, err := i.ClientConfig.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	opts := paho.NewClientOptions()
+	for _, server := range i.Servers {
+		if !strings.Contains(server, "://") {
+			if tlsConfig == nil {
+				server = "tcp://" + server
+			} else {
+				server = "ssl://" + server
+			}
+		}
+		opts.AddBroker(server)
+	}
+	if tlsConfig != nil {
+		opts.SetTLSConfig(tlsConfig)
+	}
+	clientID := i.ClientID
+	if clientID == "" {
+		clientID = "forwarder-" + strconv.FormatInt(rand.Int63(), 36)
+	}
+	opts.SetClientID(clientID)
+	opts.SetUsername(i.Username)
+	opts.SetPassword(i.Password)
+	opts.SetConnectTimeout(time.Duration(i.ConnectionTimeout))
+	opts.SetCleanSession(!i.PersistentSession)
+	opts.SetAutoAckDisabled(true)
+	opts.SetAutoReconnect(true)
+	opts.SetConnectRetry(true)
+	// onMessage waits while the tracker or the edge is full, which would
+	// stop paho from reading the connection, pings included, if it ran in
+	// order. The tracker still acks in the order the messages were added.
+	opts.SetOrderMatters(false)
+	opts.SetDefaultPublishHandler(i.onMessage)
+	opts.SetOnConnectHandler(func(paho.Client) {
+		i.subscribe()
+	})
+	opts.SetReconnectingHandler(func(paho.Client, *paho.ClientOptions) {
+		// the acks of the messages of the lost session would go to the
+		// messages of the same id of the next one
+		i.resetTracker()
+	})
+	opts.SetConnectionLostHandler(func(_ paho.Client, err error) {
+		i.log.Warn("connection lost", zap.Strings("servers", i.Servers), zap.Error(err))
+	})
+	return opts, nil
+}
+
+// Start connects to the broker in the background, retrying until Stop.
+func (i *Input) Start(_ edge.Edge, out edge.Edge) error {
+	i.out = out
+	i.replayer.Node = i.AliasOr(nodeName)
+	i.replayer.Out = out
+	i.replayer.MaxReplays = i.MaxReplays
+	i.replayer.ReplayBackoff = time.Duration(i.ReplayBackoff)
+	i.replayer.Held = "deliver record fail, hold its ack"
+	i.replayer.Log = i.log
+	i.ctx, i.cancel = context.WithCancel(context.Background())
+	i.readCtx, i.readCancel = context.WithCancel(i.ctx)
+	i.resetTracker()
+	i.client = i.ClientCreator.Create(i.opts)
+	i.client.Connect()
+	return nil
+}
+
+func (i *Input) subscribe() {
+	filters := make(map[string]byte, len(i.Topics))
+	for _, topic := range i.Topics {
+		filters[topic] = byte(i.QoS)
+	}
+	// the messages go to the default handler, also the ones of a persistent
+	// session received before the subscription
+	token := i.client.SubscribeMultiple(filters, nil)
+	if !token.WaitTimeout(time.Duration(i.ConnectionTimeout)) {
+		i.log.Error("subscribe timed out", zap.Strings("topics", i.Topics))
+		return
+	}
+	if err := token.Error(); err != nil {
+		i.log.Error("subscribe", zap.Strings("topics", i.Topics), zap.Error(err))
+		return
+	}
+	i.log.Info("subscribed", zap.Strings("servers", i.Servers), zap.Strings("topics", i.Topics))
+}
+
+func (i *Input) resetTracker() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.tracker != nil {
+		i.tracker.close()
+	}
+	i.tracker = newAckTracker(i.MaxUndeliveredMessages)
+}
+
+// SetDeadLetter makes the input write the messages that fail for good to w
+// instead of dropping them or holding their ack.
+func (i *Input) SetDeadLetter(w deadletter.Writer) {
+	i.replayer.DeadLetter = w
+}
+
+// Check reports whether the input is connected to the broker.
+func (i *Input) Check() error {
+	if i.client == nil || !i.client.IsConnectionOpen() {
+		return errors.New("not connected")
+	}
+	return nil
+}
+
+// Pause stops handing messages to the dag but keeps the session, so the
+// records in flight can still be acked until Stop.
+func (i *Input) Pause() error {
+	if i.readCancel != nil {
+		i.readCancel()
+	}
+	return nil
+}
+
+// Stop waits for the records in flight to be delivered, so that their
+// messages are acked, and disconnects.
+func (i *Input) Stop() error {
+	if i.cancel == nil {
+		return nil
+	}
+	i.readCancel()
+	done := make(chan struct{})
+	go func() {
+		i.inflight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(cleanupTimeout):
+		i.log.Warn("records are still in flight, their messages are not acked")
+	}
+	i.cancel()
+	i.cancel = nil
+	i.client.Disconnect(disconnectQuiesce)
+	i.resetTracker()
+	return nil
+}
+
+// onMessage is the handler of the messages of the client, it blocks while
+// the edge is full.
+func (i *Input) onMessage(_ paho.Client, msg paho.Message) {
+	if i.readCtx.Err() != nil {
+		// not acked, the broker delivers it again in the next session
+		return
+	}
+	i.mu.Lock()
+	tr := i.tracker
+	i.mu.Unlock()
+	pm, ok := tr.add(i.readCtx, msg)
+	if !ok {
+		return
+	}
+
+	record := &edge.Record{
+		Payload: msg.Payload(),
+		Source: edge.Source{
+			Topic:     msg.Topic(),
+			Offset:    int64(msg.MessageID()),
+			Timestamp: time.Now(),
+			Tags:      i.topicTags(msg.Topic()),
+		},
+		Attempts: 1,
+	}
+	record.Done = func(r *edge.Record, err error) {
+		i.replayer.Done(i.ctx, r, err, func() { tr.delivered(pm) }, i.inflight.Done,
+			zap.String("topic", r.Source.Topic))
+	}
+	i.inflight.Add(1)
+	select {
+	case i.out.In() <- record:
+		metrics.NodeRecords.WithLabelValues(i.AliasOr(nodeName), metrics.Out).Inc()
+	case <-i.readCtx.Done():
+		i.inflight.Done()
+	}
+}
+
+// topicTags returns the tags of the points of the messages of topic.
+func (i *Input) topicTags(topic string) map[string]string {
+	var tags map[string]string
+	if i.TopicTag != "" {
+		tags = map[string]string{i.TopicTag: topic}
+	}
+	if len(i.TopicParsing) == 0 {
+		return tags
+	}
+	segments := strings.Split(topic, "/")
+	for _, p := range i.TopicParsing {
+		if !p.match(segments) {
+			continue
+		}
+		for j, tag := range p.tags {
+			if tag == "_" || tag == "" {
+				continue
+			}
+			if tags == nil {
+				tags = make(map[string]string, len(p.tags))
+			}
+			tags[tag] = segments[j]
+		}
+	}
+	return tags
+}
+
+func init() {
+	inputs.Add(nodeName, func() node.Node {
+		return &Input{MaxReplays: delivery.DefaultMaxReplays}
+	})
+}
@@ -0,0 +1,213 @@
+/*
+Copyright 2022 Huawei Cloud Computing Technologies Co., Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mqtt_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/openGemini/openGemini-forwarder/edge"
+	"github.com/openGemini/openGemini-forwarder/lib/logger"
+	"github.com/openGemini/openGemini-forwarder/plugins/inputs"
+	"github.com/openGemini/openGemini-forwarder/plugins/inputs/mqtt"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func init() {
+	logger.SetLogger(zap.NewNop())
+}
+
+type doneToken struct {
+	err error
+}
+
+func (t *doneToken) Wait() bool                     { return true }
+func (t *doneToken) WaitTimeout(time.Duration) bool { return true }
+func (t *doneToken) Error() error                   { return t.err }
+func (t *doneToken) Done() <-chan struct{} {
+	c := make(chan struct{})
+	close(c)
+	return c
+}
+
+// fakeClient connects at once and records the subscriptions.
+type fakeClient struct {
+	opts       *paho.ClientOptions
+	subscribed chan map[string]byte
+	connected  bool
+}
+
+func (c *fakeClient) Create(opts *paho.ClientOptions) mqtt.Client {
+	c.opts = opts
+	return c
+}
+
+func (c *fakeClient) Connect() paho.Token {
+	c.connected = true
+	go c.opts.OnConnect(nil)
+	return &doneToken{}
+}
+
+func (c *fakeClient) SubscribeMultiple(filters map[string]byte, _ paho.MessageHandler) paho.Token {
+	c.subscribed <- filters
+	return &doneToken{}
+}
+
+func (c *fakeClient) IsConnectionOpen() bool {
+	return c.connected
+}
+
+func (c *fakeClient) Disconnect(uint) {
+	c.connected = false
+}
+
+type message struct {
+	topic string
+	id    uint16
+	acked chan uint16
+}
+
+func (m *message) Duplicate() bool   { return false }
+func (m *message) Qos() byte         { return 1 }
+func (m *message) Retained() bool    { return false }
+func (m *message) Topic() string     { return m.topic }
+func (m *message) MessageID() uint16 { return m.id }
+func (m *message) Payload() []byte   { return []byte("m v=1") }
+func (m *message) Ack()              { m.acked <- m.id }
+
+func receive(t *testing.T, e edge.Edge) *edge.Record {
+	t.Helper()
+	select {
+	case r := <-e.Out():
+		return r
+	case <-time.After(5 * time.Second):
+		t.Fatal("no record")
+		return nil
+	}
+}
+
+func TestInput(t *testing.T) {
+	client := &fakeClient{subscribed: make(chan map[string]byte, 1)}
+	i := inputs.GetInputs()["mqtt_consumer"]().(*mqtt.Input)
+	i.Servers = []string{"localhost:1883"}
+	i.Topics = []string{"sensors/#"}
+	i.QoS = 1
+	i.TopicTag = "topic"
+	i.TopicParsing = []mqtt.TopicParsing{{Topic: "sensors/+/temp", Tags: "_/device/_"}}
+	i.ClientCreator = client
+	if !assert.NoError(t, i.Init()) {
+		return
+	}
+	out := edge.NewEdge("out", 10)
+	if !assert.NoError(t, i.Start(nil, out)) {
+		return
+	}
+	defer i.Stop()
+	assert.Equal(t, map[string]byte{"sensors/#": 1}, <-client.subscribed)
+	assert.NoError(t, i.Check())
+	assert.Equal(t, []string{"tcp://localhost:1883"}, []string{client.opts.Servers[0].String()})
+	assert.True(t, client.opts.AutoAckDisabled)
+
+	acked := make(chan uint16, 10)
+	publish := func(topic string, id uint16) {
+		client.opts.DefaultPublishHandler(nil, &message{topic: topic, id: id, acked: acked})
+	}
+	publish("sensors/a/temp", 1)
+	publish("sensors/b/hum", 2)
+	r1, r2 := receive(t, out), receive(t, out)
+	assert.Equal(t, map[string]string{"topic": "sensors/a/temp", "device": "a"}, r1.Source.Tags)
+	assert.Equal(t, map[string]string{"topic": "sensors/b/hum"}, r2.Source.Tags)
+
+	// acked in order
+	r2.Ack()
+	assert.Len(t, acked, 0)
+	r1.Nack(edge.Permanent(errors.New("invalid")))
+	assert.Equal(t, uint16(1), <-acked)
+	assert.Equal(t, uint16(2), <-acked)
+
+	// the acks of a lost session are not sent
+	publish("sensors/a/temp", 3)
+	r3 := receive(t, out)
+	client.opts.OnReconnecting(nil, client.opts)
+	publish("sensors/a/temp", 3)
+	r3.Ack()
+	receive(t, out).Ack()
+	assert.Equal(t, uint16(3), <-acked)
+	assert.Len(t, acked, 0)
+}
+
+func TestInputPause(t *testing.T) {
+	client := &fakeClient{subscribed: make(chan map[string]byte, 1)}
+	i := inputs.GetInputs()["mqtt_consumer"]().(*mqtt.Input)
+	i.Servers = []string{"tcp://localhost:1883"}
+	i.Topics = []string{"a"}
+	i.ClientCreator = client
+	if !assert.NoError(t, i.Init()) {
+		return
+	}
+	out := edge.NewEdge("out", 10)
+	if !assert.NoError(t, i.Start(nil, out)) {
+		return
+	}
+	<-client.subscribed
+
+	acked := make(chan uint16, 10)
+	client.opts.DefaultPublishHandler(nil, &message{topic: "a", id: 1, acked: acked})
+	r := receive(t, out)
+	assert.NoError(t, i.Pause())
+	client.opts.DefaultPublishHandler(nil, &message{topic: "a", id: 2, acked: acked})
+	assert.Len(t, out.Out(), 0)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		assert.NoError(t, i.Stop())
+	}()
+	r.Ack()
+	wg.Wait()
+	assert.Equal(t, uint16(1), <-acked)
+	assert.Len(t, acked, 0)
+	assert.Error(t, i.Check())
+}
+
+func TestInputValidate(t *testing.T) {
+	valid := func() *mqtt.Input {
+		return &mqtt.Input{Servers: []string{"tcp://localhost:1883"}, Topics: []string{"a"}}
+	}
+	assert.NoError(t, valid().Validate())
+
+	i := valid()
+	i.QoS = 3
+	assert.Error(t, i.Validate())
+
+	i = valid()
+	i.PersistentSession = true
+	assert.Error(t, i.Validate())
+
+	i = valid()
+	i.TopicParsing = []mqtt.TopicParsing{{Topic: "a/+", Tags: "_"}}
+	assert.Error(t, i.Validate())
+
+	i = valid()
+	i.TopicParsing = []mqtt.TopicParsing{{Topic: "a/#", Tags: "_/b"}}
+	assert.Error(t, i.Validate())
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2022 Huawei Cloud Computing Technologies Co., Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mqtt
+
+import (
+	"context"
+	"sync"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+)
+
+type pendingMessage struct {
+	msg       paho.Message
+	delivered bool
+}
+
+// ackTracker acks the messages in the order they were added, a message
+// only once every message received before it has been delivered, so that a
+// message that is still in flight or failed is delivered again by the
+// broker in the next session. There is one tracker per connection, the one
+// of a lost connection is closed.
+type ackTracker struct {
+	// limit bounds the pending messages, so that a failed message whose ack
+	// is held stops the receiving instead of piling up the messages behind
+	// it.
+	limit int
+
+	mu      sync.Mutex
+	pending []*pendingMessage
+	trimmed chan struct{}
+	closed  bool
+}
+
+func newAckTracker(limit int) *ackTracker {
+	return &ackTracker{limit: limit}
+}
+
+// add registers a received message. It waits while too many messages are
+// pending and returns false if ctx is done meanwhile or the tracker is
+// closed.
+func (t *ackTracker) add(ctx context.Context, msg paho.Message) (*pendingMessage, bool) {
+	for {
+		t.mu.Lock()
+		if t.closed {
+			t.mu.Unlock()
+			return nil, false
+		}
+		if t.limit <= 0 || len(t.pending) < t.limit {
+			m := &pendingMessage{msg: msg}
+			t.pending = append(t.pending, m)
+			t.mu.Unlock()
+			return m, true
+		}
+		if t.trimmed == nil {
+			t.trimmed = make(chan struct{})
+		}
+		trimmed := t.trimmed
+		t.mu.Unlock()
+
+		select {
+		case <-trimmed:
+		case <-ctx.Done():
+			return nil, false
+		}
+	}
+}
+
+// delivered records that m was delivered and acks the messages up to the
+// first one that is not.
+func (t *ackTracker) delivered(m *pendingMessage) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return
+	}
+	m.delivered = true
+
+	n := 0
+	for n < len(t.pending) && t.pending[n].delivered {
+		t.pending[n].msg.Ack()
+		n++
+	}
+	if n == 0 {
+		return
+	}
+	t.pending = t.pending[n:]
+	t.wake()
+}
+
+// close stops the tracker from acking, the broker delivers the pending
+// messages again in the next session.
+func (t *ackTracker) close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closed = true
+	t.pending = nil
+	t.wake()
+}
+
+func (t *ackTracker) wake() {
+	if t.trimmed != nil {
+		close(t.trimmed)
+		t.trimmed = nil
+	}
+}
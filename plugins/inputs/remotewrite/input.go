@@ -0,0 +1,130 @@
+/*
+Copyright 2022 Huawei Cloud Computing Technologies Co., Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package remotewrite
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/influxdata/influxdb/models"
+	"github.com/openGemini/openGemini-forwarder/dag/node"
+	"github.com/openGemini/openGemini-forwarder/edge"
+	"github.com/openGemini/openGemini-forwarder/plugins/inputs"
+	"github.com/openGemini/openGemini-forwarder/plugins/inputs/listener"
+	"github.com/prometheus/prometheus/prompb"
+)
+
+//go:embed sample.conf
+var sampleConfig string
+
+const (
+	defaultPath = "/api/v1/write"
+
+	// nameLabel is the label of the metric name
+	nameLabel  = "__name__"
+	valueField = "value"
+)
+
+// Input receives the remote_write requests of Prometheus, snappy compressed
+// protobuf WriteRequests. Each sample becomes a point of the measurement of
+// its metric name, tagged with the other labels, with a value field. The
+// samples of a request are emitted as one record of line protocol, the
+// samples whose value line protocol cannot hold, such as the NaN of stale
+// markers, are skipped.
+type Input struct {
+	listener.Config
+
+	*listener.Listener `toml:"-"`
+}
+
+func (i *Input) Name() string {
+	return "prometheus_remote_write"
+}
+
+func (*Input) SampleConfig() string {
+	return sampleConfig
+}
+
+func (i *Input) Start(_ edge.Edge, out edge.Edge) error {
+	return i.Listener.Start(out)
+}
+
+func (i *Input) decode(_ *http.Request, body []byte) (*edge.Record, error) {
+	n, err := snappy.DecodedLen(body)
+	if err != nil {
+		return nil, fmt.Errorf("snappy: %v", err)
+	}
+	if int64(n) > int64(i.MaxBodySize) {
+		return nil, errors.New("decoded request body too large")
+	}
+	b, err := snappy.Decode(nil, body)
+	if err != nil {
+		return nil, fmt.Errorf("snappy: %v", err)
+	}
+	var req prompb.WriteRequest
+	if err := req.Unmarshal(b); err != nil {
+		return nil, fmt.Errorf("protobuf: %v", err)
+	}
+
+	var payload []byte
+	for _, ts := range req.Timeseries {
+		var name string
+		tags := make(map[string]string, len(ts.Labels))
+		for _, l := range ts.Labels {
+			switch {
+			case l.Name == nameLabel:
+				name = l.Value
+			case l.Value != "":
+				tags[l.Name] = l.Value
+			}
+		}
+		if name == "" {
+			return nil, errors.New("time series without metric name")
+		}
+		for _, s := range ts.Samples {
+			if math.IsNaN(s.Value) || math.IsInf(s.Value, 0) {
+				continue
+			}
+			pt, err := models.NewPoint(name, models.NewTags(tags), models.Fields{valueField: s.Value},
+				time.Unix(0, s.Timestamp*int64(time.Millisecond)))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", name, err)
+			}
+			if len(payload) > 0 {
+				payload = append(payload, '\n')
+			}
+			payload = pt.AppendString(payload)
+		}
+	}
+	if len(payload) == 0 {
+		return nil, nil
+	}
+	return &edge.Record{Payload: payload, Source: edge.Source{Timestamp: time.Now()}}, nil
+}
+
+func init() {
+	inputs.Add("prometheus_remote_write", func() node.Node {
+		i := &Input{Config: listener.NewConfig(defaultPath)}
+		i.Listener = listener.New(i.Name(), &i.Config, i.decode)
+		return i
+	})
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2022 Huawei Cloud Computing Technologies Co., Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package remotewrite_test
+
+import (
+	"bytes"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/snappy"
+	"github.com/openGemini/openGemini-forwarder/edge"
+	"github.com/openGemini/openGemini-forwarder/lib/logger"
+	"github.com/openGemini/openGemini-forwarder/plugins/inputs"
+	"github.com/openGemini/openGemini-forwarder/plugins/inputs/remotewrite"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func init() {
+	logger.SetLogger(zap.NewNop())
+}
+
+func write(t *testing.T, h http.Handler, req *prompb.WriteRequest) int {
+	b, err := req.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/write", bytes.NewReader(snappy.Encode(nil, b)))
+	r.Header.Set("Content-Encoding", "snappy")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w.Code
+}
+
+func labels(kv ...string) []prompb.Label {
+	var l []prompb.Label
+	for i := 0; i < len(kv); i += 2 {
+		l = append(l, prompb.Label{Name: kv[i], Value: kv[i+1]})
+	}
+	return l
+}
+
+func TestInput(t *testing.T) {
+	i := inputs.GetInputs()["prometheus_remote_write"]().(*remotewrite.Input)
+	if !assert.NoError(t, i.Init()) {
+		return
+	}
+	assert.Equal(t, "/api/v1/write", i.Pattern())
+	out := edge.NewEdge("out", 1)
+	if !assert.NoError(t, i.Start(nil, out)) {
+		return
+	}
+	defer i.Stop()
+
+	code := write(t, i, &prompb.WriteRequest{Timeseries: []prompb.TimeSeries{
+		{
+			Labels:  labels("__name__", "up", "job", "node", "instance", "a:9100", "empty", ""),
+			Samples: []prompb.Sample{{Value: 1, Timestamp: 1000}, {Value: math.NaN(), Timestamp: 2000}},
+		},
+		{
+			Labels:  labels("__name__", "http_requests_total"),
+			Samples: []prompb.Sample{{Value: 12.5, Timestamp: 3000}},
+		},
+	}})
+	if assert.Equal(t, http.StatusNoContent, code) {
+		record := <-out.Out()
+		assert.Equal(t, "up,instance=a:9100,job=node value=1 1000000000\nhttp_requests_total value=12.5 3000000000",
+			string(record.Payload))
+	}
+
+	// only stale markers, nothing to emit
+	code = write(t, i, &prompb.WriteRequest{Timeseries: []prompb.TimeSeries{{
+		Labels:  labels("__name__", "up"),
+		Samples: []prompb.Sample{{Value: math.NaN(), Timestamp: 1000}},
+	}}})
+	assert.Equal(t, http.StatusNoContent, code)
+	assert.Len(t, out.Out(), 0)
+
+	code = write(t, i, &prompb.WriteRequest{Timeseries: []prompb.TimeSeries{{
+		Labels:  labels("job", "node"),
+		Samples: []prompb.Sample{{Value: 1, Timestamp: 1000}},
+	}}})
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/write", bytes.NewReader([]byte("up 1")))
+	w := httptest.NewRecorder()
+	i.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
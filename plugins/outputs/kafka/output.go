@@ -0,0 +1,332 @@
+/*
+Copyright 2022 Huawei Cloud Computing Technologies Co., Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kafka
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	itoml "github.com/influxdata/influxdb/toml"
+	"github.com/influxdata/telegraf/plugins/common/kafka"
+	"github.com/openGemini/openGemini-forwarder/dag/node"
+	"github.com/openGemini/openGemini-forwarder/edge"
+	kafkalogger "github.com/openGemini/openGemini-forwarder/lib/adaptor/telegraf/logger"
+	"github.com/openGemini/openGemini-forwarder/lib/logger"
+	"github.com/openGemini/openGemini-forwarder/lib/metrics"
+	"github.com/openGemini/openGemini-forwarder/plugins/outputs"
+	"go.uber.org/zap"
+)
+
+//go:embed sample.conf
+var sampleConfig string
+
+const (
+	nodeName = "kafka_producer"
+
+	defaultBatchSize     = 1000
+	defaultFlushInterval = time.Second
+	defaultMaxRetry      = 3
+	defaultRequiredAcks  = int(sarama.WaitForAll)
+)
+
+type ProducerCreator interface {
+	Create(brokers []string, cfg *sarama.Config) (sarama.SyncProducer, error)
+}
+
+type SaramaCreator struct{}
+
+func (*SaramaCreator) Create(brokers []string, cfg *sarama.Config) (sarama.SyncProducer, error) {
+	return sarama.NewSyncProducer(brokers, cfg)
+}
+
+// Output produces the points of the records to a topic, one message of
+// line protocol per point. A record without points is produced as one
+// message of its payload.
+type Output struct {
+	node.Alias
+
+	Brokers []string `toml:"brokers"`
+	Topic   string   `toml:"topic"`
+	// RoutingTag names the tag whose value is the key of the messages, the
+	// points with the same key go to the same partition.
+	RoutingTag string `toml:"routing_tag"`
+
+	// BatchSize is the maximum number of records produced at once.
+	BatchSize int `toml:"batch_size"`
+	// FlushInterval is the longest time a record waits for its batch to
+	// fill up before the batch is produced.
+	FlushInterval itoml.Duration `toml:"flush_interval"`
+
+	kafka.WriteConfig
+
+	kafka.Logger
+
+	ProducerCreator ProducerCreator `toml:"-"`
+	producer        sarama.SyncProducer
+	config          *sarama.Config
+	log             *logger.Logger
+
+	mu      sync.Mutex
+	lastErr error
+
+	wg     sync.WaitGroup
+	cancel context.CancelFunc
+}
+
+func (o *Output) Name() string {
+	return nodeName
+}
+
+func (*Output) SampleConfig() string {
+	return sampleConfig
+}
+
+// Validate validates that the configuration is acceptable.
+func (o *Output) Validate() error {
+	if len(o.Brokers) == 0 {
+		return errors.New("no brokers")
+	}
+	if o.Topic == "" {
+		return errors.New("no topic")
+	}
+	switch sarama.RequiredAcks(o.RequiredAcks) {
+	case sarama.NoResponse, sarama.WaitForLocal, sarama.WaitForAll:
+	default:
+		return fmt.Errorf("invalid required_acks %d, must be -1, 0 or 1", o.RequiredAcks)
+	}
+	switch sarama.CompressionCodec(o.CompressionCodec) {
+	case sarama.CompressionNone, sarama.CompressionGZIP, sarama.CompressionSnappy,
+		sarama.CompressionLZ4, sarama.CompressionZSTD:
+	default:
+		return fmt.Errorf("invalid compression_codec %d", o.CompressionCodec)
+	}
+	if o.MaxRetry < 0 {
+		return fmt.Errorf("invalid max_retry %d", o.MaxRetry)
+	}
+	return nil
+}
+
+func (o *Output) Init() error {
+	if err := o.Validate(); err != nil {
+		return err
+	}
+	o.SetLogger()
+	o.log = logger.NewLogger(o.Name())
+
+	if o.BatchSize <= 0 {
+		o.BatchSize = defaultBatchSize
+	}
+	if o.FlushInterval <= 0 {
+		o.FlushInterval = itoml.Duration(defaultFlushInterval)
+	}
+
+	cfg := sarama.NewConfig()
+	if err := o.WriteConfig.SetConfig(cfg, kafkalogger.Logger{Log: o.log}); err != nil {
+		return fmt.Errorf("SetConfig: %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	o.config = cfg
+
+	if o.ProducerCreator == nil {
+		o.ProducerCreator = &SaramaCreator{}
+	}
+	return nil
+}
+
+// Check reports whether the last batch was produced.
+func (o *Output) Check() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.lastErr != nil {
+		return fmt.Errorf("last batch failed: %v", o.lastErr)
+	}
+	return nil
+}
+
+// Start connects to the brokers and batches the records read from in. A
+// batch is produced when it holds BatchSize records, and at least every
+// FlushInterval.
+func (o *Output) Start(in edge.Edge, _ edge.Edge) error {
+	producer, err := o.ProducerCreator.Create(o.Brokers, o.config)
+	if err != nil {
+		return fmt.Errorf("create producer: %w", err)
+	}
+	o.producer = producer
+
+	ctx, cancel := context.WithCancel(context.Background())
+	o.cancel = cancel
+	o.wg.Add(1)
+	go func() {
+		defer o.wg.Done()
+		ticker := time.NewTicker(time.Duration(o.FlushInterval))
+		defer ticker.Stop()
+		batch := make([]*edge.Record, 0, o.BatchSize)
+		for {
+			select {
+			case <-ctx.Done():
+				// the records read so far are owned by the output
+				o.write(batch)
+				return
+			case record := <-in.Out():
+				metrics.NodeRecords.WithLabelValues(o.AliasOr(o.Name()), metrics.In).Inc()
+				batch = append(batch, record)
+				if len(batch) < o.BatchSize {
+					continue
+				}
+			case <-ticker.C:
+			}
+			o.write(batch)
+			batch = batch[:0]
+		}
+	}()
+	return nil
+}
+
+// Stop stops reading records, the pending batch is produced before the
+// producer is closed.
+func (o *Output) Stop() error {
+	if o.cancel == nil {
+		return nil
+	}
+	o.cancel()
+	o.wg.Wait()
+	o.cancel = nil
+	return o.producer.Close()
+}
+
+// write produces the messages of the batch and reports the result to every
+// record of it, a record is acked once all its messages are produced.
+func (o *Output) write(batch []*edge.Record) {
+	if len(batch) == 0 {
+		return
+	}
+	msgs := make([]*sarama.ProducerMessage, 0, len(batch))
+	valid := batch[:0]
+	for _, rec := range batch {
+		recordMsgs, err := o.messages(rec)
+		if err != nil {
+			metrics.NodeRecords.WithLabelValues(o.AliasOr(o.Name()), metrics.Dropped).Inc()
+			rec.Nack(edge.Permanent(edge.WithStage(o.Name(), fmt.Errorf("encode record: %v", err))))
+			continue
+		}
+		for _, msg := range recordMsgs {
+			msg.Metadata = len(valid)
+		}
+		msgs = append(msgs, recordMsgs...)
+		valid = append(valid, rec)
+	}
+	if len(valid) == 0 {
+		return
+	}
+
+	start := time.Now()
+	var err error
+	if len(msgs) > 0 {
+		err = o.producer.SendMessages(msgs)
+	}
+	metrics.OutputWriteDuration.WithLabelValues(o.Name()).Observe(time.Since(start).Seconds())
+
+	failed := make([]error, len(valid))
+	var perrs sarama.ProducerErrors
+	switch {
+	case err == nil:
+	case errors.As(err, &perrs):
+		for _, pe := range perrs {
+			i, ok := pe.Msg.Metadata.(int)
+			if ok && failed[i] == nil {
+				failed[i] = producerError(pe.Err)
+			}
+		}
+	default:
+		for i := range failed {
+			failed[i] = producerError(err)
+		}
+	}
+	if err != nil {
+		metrics.OutputWriteErrors.WithLabelValues(o.Name()).Inc()
+		o.log.Error("produce batch fail", zap.Int("records", len(valid)), zap.Int("messages", len(msgs)),
+			zap.Duration("duration", time.Since(start)), zap.Error(err))
+	}
+	o.mu.Lock()
+	o.lastErr = err
+	o.mu.Unlock()
+
+	for i, rec := range valid {
+		if failed[i] != nil {
+			metrics.NodeRecords.WithLabelValues(o.AliasOr(o.Name()), metrics.Dropped).Inc()
+			rec.Nack(edge.WithStage(o.Name(), failed[i]))
+		} else {
+			metrics.NodeRecords.WithLabelValues(o.AliasOr(o.Name()), metrics.Out).Inc()
+			rec.Ack()
+		}
+	}
+}
+
+// messages returns the messages of the record, keyed by the routing tag.
+func (o *Output) messages(rec *edge.Record) ([]*sarama.ProducerMessage, error) {
+	if len(rec.Points) == 0 {
+		if len(rec.Payload) == 0 {
+			return nil, nil
+		}
+		return []*sarama.ProducerMessage{{Topic: o.Topic, Value: sarama.ByteEncoder(rec.Payload)}}, nil
+	}
+
+	msgs := make([]*sarama.ProducerMessage, 0, len(rec.Points))
+	for i := range rec.Points {
+		p := &rec.Points[i]
+		line, err := p.AppendLineProtocol(nil)
+		if err != nil {
+			return nil, err
+		}
+		msg := &sarama.ProducerMessage{Topic: o.Topic, Value: sarama.ByteEncoder(line)}
+		if v, ok := p.Tags[o.RoutingTag]; ok && o.RoutingTag != "" {
+			msg.Key = sarama.StringEncoder(v)
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, nil
+}
+
+// producerError marks the errors that producing the message again cannot
+// fix as permanent.
+func producerError(err error) error {
+	switch {
+	case errors.Is(err, sarama.ErrMessageSizeTooLarge),
+		errors.Is(err, sarama.ErrInvalidMessage),
+		errors.Is(err, sarama.ErrInvalidMessageSize):
+		return edge.Permanent(err)
+	}
+	return err
+}
+
+func init() {
+	outputs.Add(nodeName, func() node.Node {
+		// 0 disables the retries and the acks, so the defaults are set
+		// before decoding
+		o := &Output{}
+		o.MaxRetry = defaultMaxRetry
+		o.RequiredAcks = defaultRequiredAcks
+		return o
+	})
+}
@@ -0,0 +1,173 @@
+/*
+Copyright 2022 Huawei Cloud Computing Technologies Co., Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kafka_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	itoml "github.com/influxdata/influxdb/toml"
+	"github.com/openGemini/openGemini-forwarder/edge"
+	"github.com/openGemini/openGemini-forwarder/lib/logger"
+	"github.com/openGemini/openGemini-forwarder/plugins/outputs"
+	"github.com/openGemini/openGemini-forwarder/plugins/outputs/kafka"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func init() {
+	logger.SetLogger(zap.NewNop())
+}
+
+type mockCreator struct {
+	producer *mocks.SyncProducer
+}
+
+func (c *mockCreator) Create([]string, *sarama.Config) (sarama.SyncProducer, error) {
+	return c.producer, nil
+}
+
+// expectMessage checks the key and value of the next message.
+func expectMessage(key, value string) mocks.MessageChecker {
+	return func(msg *sarama.ProducerMessage) error {
+		var k string
+		if msg.Key != nil {
+			b, _ := msg.Key.Encode()
+			k = string(b)
+		}
+		v, _ := msg.Value.Encode()
+		if msg.Topic != "out" || k != key || string(v) != value {
+			return fmt.Errorf("unexpected message %s %q %q", msg.Topic, k, v)
+		}
+		return nil
+	}
+}
+
+func newOutput(t *testing.T, producer *mocks.SyncProducer) (*kafka.Output, edge.Edge) {
+	o := outputs.GetOutputs()["kafka_producer"]().(*kafka.Output)
+	o.Brokers = []string{"localhost:9092"}
+	o.Topic = "out"
+	o.RoutingTag = "host"
+	o.BatchSize = 2
+	o.FlushInterval = itoml.Duration(10 * time.Millisecond)
+	o.ProducerCreator = &mockCreator{producer: producer}
+	if err := o.Init(); err != nil {
+		t.Fatal(err)
+	}
+	in := edge.NewEdge("in", 10)
+	if err := o.Start(in, nil); err != nil {
+		t.Fatal(err)
+	}
+	return o, in
+}
+
+func record(done chan error, points ...edge.Point) *edge.Record {
+	return &edge.Record{
+		Points: points,
+		Done:   func(_ *edge.Record, err error) { done <- err },
+	}
+}
+
+func wait(t *testing.T, done chan error) error {
+	t.Helper()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("record not done")
+		return nil
+	}
+}
+
+func TestOutput(t *testing.T) {
+	producer := mocks.NewSyncProducer(t, nil)
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(expectMessage("a", "cpu,host=a usage=1 10"))
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(expectMessage("", "mem free=2i 20"))
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(expectMessage("", "disk used=3i"))
+	o, in := newOutput(t, producer)
+
+	done := make(chan error, 2)
+	in.In() <- record(done,
+		edge.Point{Measurement: "cpu", Tags: map[string]string{"host": "a"},
+			Fields: map[string]interface{}{"usage": 1.0}, Time: time.Unix(0, 10)},
+		edge.Point{Measurement: "mem", Fields: map[string]interface{}{"free": int64(2)}, Time: time.Unix(0, 20)},
+	)
+	in.In() <- &edge.Record{
+		Payload: []byte("disk used=3i"),
+		Done:    func(_ *edge.Record, err error) { done <- err },
+	}
+	assert.NoError(t, wait(t, done))
+	assert.NoError(t, wait(t, done))
+	assert.NoError(t, o.Check())
+	assert.NoError(t, o.Stop())
+}
+
+func TestOutputFail(t *testing.T) {
+	producer := mocks.NewSyncProducer(t, nil)
+	producer.ExpectSendMessageAndFail(sarama.ErrMessageSizeTooLarge)
+	producer.ExpectSendMessageAndFail(sarama.ErrOutOfBrokers)
+	o, in := newOutput(t, producer)
+
+	done := make(chan error, 1)
+	point := edge.Point{Measurement: "cpu", Fields: map[string]interface{}{"usage": 1.0}}
+	in.In() <- record(done, point)
+	err := wait(t, done)
+	assert.True(t, edge.IsPermanent(err), err)
+	assert.Equal(t, "kafka_producer", edge.Stage(err))
+	assert.Error(t, o.Check())
+
+	in.In() <- record(done, point)
+	err = wait(t, done)
+	assert.True(t, errors.Is(err, sarama.ErrOutOfBrokers))
+	assert.False(t, edge.IsPermanent(err))
+
+	// a point line protocol cannot hold
+	in.In() <- record(done, edge.Point{Measurement: "cpu"})
+	assert.True(t, edge.IsPermanent(wait(t, done)))
+	assert.NoError(t, o.Stop())
+}
+
+func TestOutputValidate(t *testing.T) {
+	valid := func() *kafka.Output {
+		o := outputs.GetOutputs()["kafka_producer"]().(*kafka.Output)
+		o.Brokers = []string{"localhost:9092"}
+		o.Topic = "out"
+		return o
+	}
+	assert.NoError(t, valid().Validate())
+
+	o := valid()
+	o.Topic = ""
+	assert.Error(t, o.Validate())
+
+	o = valid()
+	o.RequiredAcks = 2
+	assert.Error(t, o.Validate())
+
+	o = valid()
+	o.CompressionCodec = 5
+	assert.Error(t, o.Validate())
+
+	// zstd needs a newer protocol version
+	o = valid()
+	o.CompressionCodec = int(sarama.CompressionZSTD)
+	assert.Error(t, o.Init())
+}
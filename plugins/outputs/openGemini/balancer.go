@@ -0,0 +1,142 @@
+/*
+Copyright 2022 Huawei Cloud Computing Technologies Co., Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openGemini
+
+import (
+	"fmt"
+	"math/rand"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// strategies to spread the writes over the urls
+const (
+	strategyRoundRobin = "round_robin"
+	strategyRandom     = "random"
+	strategyFailover   = "failover"
+)
+
+// endpoint is one of the configured urls.
+type endpoint struct {
+	host    string
+	write   url.URL
+	pingURL string
+	// down is 1 while the endpoint is out of rotation.
+	down int32
+}
+
+// writeURL returns the url writing to the database and retention policy.
+func (e *endpoint) writeURL(t target) string {
+	u := e.write
+	q := u.Query()
+	q.Set("db", t.db)
+	if t.rp != "" {
+		q.Set("rp", t.rp)
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+func (e *endpoint) healthy() bool {
+	return atomic.LoadInt32(&e.down) == 0
+}
+
+// balancer picks the endpoint of each write. Endpoints that failed are
+// skipped until a probe marks them up again, if every endpoint is down they
+// are all tried anyway.
+type balancer struct {
+	strategy  string
+	endpoints []*endpoint
+	next      uint32
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+func newBalancer(strategy string, endpoints []*endpoint) (*balancer, error) {
+	switch strategy {
+	case "":
+		strategy = strategyRoundRobin
+	case strategyRoundRobin, strategyRandom, strategyFailover:
+	default:
+		return nil, fmt.Errorf("invalid write_strategy %q", strategy)
+	}
+	return &balancer{
+		strategy:  strategy,
+		endpoints: endpoints,
+		rand:      rand.New(rand.NewSource(time.Now().UnixNano())),
+	}, nil
+}
+
+// pick returns the endpoint to write to.
+func (b *balancer) pick() *endpoint {
+	healthy := make([]*endpoint, 0, len(b.endpoints))
+	for _, e := range b.endpoints {
+		if e.healthy() {
+			healthy = append(healthy, e)
+		}
+	}
+	if len(healthy) == 0 {
+		healthy = b.endpoints
+	}
+
+	switch b.strategy {
+	case strategyFailover:
+		// the first url is the primary, the others follow in order
+		return healthy[0]
+	case strategyRandom:
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		return healthy[b.rand.Intn(len(healthy))]
+	default:
+		n := atomic.AddUint32(&b.next, 1)
+		return healthy[int(n-1)%len(healthy)]
+	}
+}
+
+// markDown takes e out of rotation, it returns false if e was already down.
+func (b *balancer) markDown(e *endpoint) bool {
+	return atomic.CompareAndSwapInt32(&e.down, 0, 1)
+}
+
+// markUp puts e back into rotation, it returns false if e was up.
+func (b *balancer) markUp(e *endpoint) bool {
+	return atomic.CompareAndSwapInt32(&e.down, 1, 0)
+}
+
+// down returns the endpoints out of rotation.
+func (b *balancer) down() []*endpoint {
+	var down []*endpoint
+	for _, e := range b.endpoints {
+		if !e.healthy() {
+			down = append(down, e)
+		}
+	}
+	return down
+}
+
+// available reports whether an endpoint is in rotation.
+func (b *balancer) available() bool {
+	for _, e := range b.endpoints {
+		if e.healthy() {
+			return true
+		}
+	}
+	return false
+}
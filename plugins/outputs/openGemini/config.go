@@ -17,6 +17,7 @@ limitations under the License.
 package openGemini
 
 import (
+	itoml "github.com/influxdata/influxdb/toml"
 	"github.com/influxdata/telegraf/plugins/common/tls"
 )
 
@@ -27,5 +28,30 @@ type OpenGemini struct {
 	Password        string   `toml:"password"`
 	Database        string   `toml:"database"`
 	RetentionPolicy string   `toml:"retention_policy"`
+	// DatabaseHeader and RetentionPolicyHeader name the headers of the
+	// record source that override Database and RetentionPolicy, such as
+	// the db and rp parameters kept by the http_listener input.
+	DatabaseHeader        string `toml:"database_header"`
+	RetentionPolicyHeader string `toml:"retention_policy_header"`
+
+	// BatchSize is the maximum number of records written in one request.
+	BatchSize int `toml:"batch_size"`
+	// FlushInterval is the longest time a record waits for its batch to
+	// fill up before the batch is written.
+	FlushInterval itoml.Duration `toml:"flush_interval"`
+	// MaxRetries is how many times a batch that failed with a transient
+	// error is written again before its records are nacked.
+	MaxRetries   int            `toml:"max_retries"`
+	RetryBackoff itoml.Duration `toml:"retry_backoff"`
+	// Timeout bounds each write request.
+	Timeout itoml.Duration `toml:"timeout"`
+
+	// WriteStrategy spreads the writes over the urls, one of "round_robin",
+	// "random" or "failover".
+	WriteStrategy string `toml:"write_strategy"`
+	// HealthCheckInterval is how often a url that failed is probed, it is
+	// written to again once it answers.
+	HealthCheckInterval itoml.Duration `toml:"health_check_interval"`
+
 	tls.ClientConfig
 }
@@ -17,50 +17,91 @@ limitations under the License.
 package openGemini
 
 import (
+	"bytes"
 	"context"
+	_ "embed"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
 	"net/url"
+	"path"
 	"sync"
+	"sync/atomic"
+	"time"
 
-	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
-	"github.com/influxdata/influxdb-client-go/v2/api"
+	itoml "github.com/influxdata/influxdb/toml"
 	"github.com/openGemini/openGemini-forwarder/dag/node"
 	"github.com/openGemini/openGemini-forwarder/edge"
-	"github.com/openGemini/openGemini-forwarder/lib/pool"
+	"github.com/openGemini/openGemini-forwarder/lib/logger"
+	"github.com/openGemini/openGemini-forwarder/lib/metrics"
 	"github.com/openGemini/openGemini-forwarder/plugins/outputs"
+	"go.uber.org/zap"
 )
 
+//go:embed sample.conf
+var sampleConfig string
+
 var (
-	defaultURL = "http://localhost:8086"
+	defaultURL           = "http://localhost:8086"
+	defaultBatchSize     = 1000
+	defaultFlushInterval = time.Second
+	defaultMaxRetries    = 3
+	defaultRetryBackoff  = time.Second
+	defaultTimeout       = 5 * time.Second
+
+	defaultHealthCheckInterval = 10 * time.Second
 )
 
+// maxErrorBody bounds the part of an error response kept in the error.
+const maxErrorBody = 1024
+
 type Output struct {
+	node.Alias
 	OpenGemini
 
-	clients   []influxdb2.Client
-	writeApis []api.WriteAPI
+	client   *http.Client
+	balancer *balancer
+	log      *logger.Logger
 
 	wg     sync.WaitGroup
 	cancel context.CancelFunc
-
-	kafkaRecordPool *pool.KafkaRecordPool
+	// probed is set to 1 once every url was pinged after Start
+	probed int32
 }
 
 func (o *Output) Name() string {
 	return "openGemini"
 }
 
+func (*Output) SampleConfig() string {
+	return sampleConfig
+}
+
+// Stop stops reading records, the pending batch is written before the
+// client is closed.
 func (o *Output) Stop() error {
 	o.cancel()
 	o.wg.Wait()
-	for _, client := range o.clients {
-		client.Close()
-	}
+	o.client.CloseIdleConnections()
 	return nil
 }
 
-func (o *Output) Init() error {
-	o.kafkaRecordPool = pool.NewKafkaRecordPool()
+// Validate validates that the configuration is acceptable.
+func (o *Output) Validate() error {
+	if o.MaxRetries < 0 {
+		return fmt.Errorf("invalid max_retries %d", o.MaxRetries)
+	}
+	if _, err := newBalancer(o.WriteStrategy, nil); err != nil {
+		return err
+	}
+	_, err := o.parseURLs()
+	return err
+}
+
+// parseURLs returns the configured urls, or the default one.
+func (o *Output) parseURLs() ([]*url.URL, error) {
 	urls := make([]string, 0, len(o.URLs))
 	urls = append(urls, o.URLs...)
 	if o.URL != "" {
@@ -71,50 +112,326 @@ func (o *Output) Init() error {
 		urls = append(urls, defaultURL)
 	}
 
+	parsed := make([]*url.URL, 0, len(urls))
 	for _, u := range urls {
 		parts, err := url.Parse(u)
 		if err != nil {
-			return fmt.Errorf("error parsing url [%q]: %v", u, err)
+			return nil, fmt.Errorf("error parsing url [%q]: %v", u, err)
 		}
 
 		switch parts.Scheme {
 		case "http", "https":
-			c := influxdb2.NewClient(u, fmt.Sprintf("%v:%v", o.Username, o.Password))
-			o.clients = append(o.clients, c)
-			api := c.WriteAPI("", fmt.Sprintf("%v/%v", o.Database, o.RetentionPolicy))
-			o.writeApis = append(o.writeApis, api)
+			parsed = append(parsed, parts)
 		default:
-			return fmt.Errorf("unsupported scheme [%q]: %q", u, parts.Scheme)
+			return nil, fmt.Errorf("unsupported scheme [%q]: %q", u, parts.Scheme)
 		}
 	}
+	return parsed, nil
+}
+
+func (o *Output) Init() error {
+	if err := o.Validate(); err != nil {
+		return err
+	}
+	if o.BatchSize <= 0 {
+		o.BatchSize = defaultBatchSize
+	}
+	if o.FlushInterval <= 0 {
+		o.FlushInterval = itoml.Duration(defaultFlushInterval)
+	}
+	if o.RetryBackoff <= 0 {
+		o.RetryBackoff = itoml.Duration(defaultRetryBackoff)
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = itoml.Duration(defaultTimeout)
+	}
+	if o.HealthCheckInterval <= 0 {
+		o.HealthCheckInterval = itoml.Duration(defaultHealthCheckInterval)
+	}
+
+	urls, err := o.parseURLs()
+	if err != nil {
+		return err
+	}
+	endpoints := make([]*endpoint, 0, len(urls))
+	for _, u := range urls {
+		endpoints = append(endpoints, o.newEndpoint(u))
+	}
+
+	b, err := newBalancer(o.WriteStrategy, endpoints)
+	if err != nil {
+		return err
+	}
+	o.balancer = b
 
+	tlsConfig, err := o.ClientConfig.TLSConfig()
+	if err != nil {
+		return fmt.Errorf("tls config: %v", err)
+	}
+	o.client = &http.Client{
+		Timeout: time.Duration(o.Timeout),
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: tlsConfig,
+		},
+	}
+	o.log = logger.NewLogger(o.Name())
 	return nil
 }
 
+// newEndpoint returns the line protocol write and ping endpoints of the
+// server at u.
+func (o *Output) newEndpoint(u *url.URL) *endpoint {
+	w := *u
+	w.Path = path.Join(u.Path, "write")
+	q := w.Query()
+	q.Set("precision", "ns")
+	w.RawQuery = q.Encode()
+
+	p := *u
+	p.Path = path.Join(u.Path, "ping")
+	return &endpoint{host: u.Host, write: w, pingURL: p.String()}
+}
+
+// target is the database and retention policy records are written to.
+type target struct {
+	db string
+	rp string
+}
+
+// target returns where record is written, the headers of its source named
+// by DatabaseHeader and RetentionPolicyHeader override the config.
+func (o *Output) target(record *edge.Record) target {
+	t := target{db: o.Database, rp: o.RetentionPolicy}
+	headers := record.Source.Headers
+	if v := headers[o.DatabaseHeader]; o.DatabaseHeader != "" && v != "" {
+		t.db = v
+	}
+	if v := headers[o.RetentionPolicyHeader]; o.RetentionPolicyHeader != "" && v != "" {
+		t.rp = v
+	}
+	return t
+}
+
+// Check reports whether one of the urls is reachable.
+func (o *Output) Check() error {
+	if atomic.LoadInt32(&o.probed) == 0 {
+		return errors.New("urls not probed yet")
+	}
+	if !o.balancer.available() {
+		return errors.New("no url is reachable")
+	}
+	return nil
+}
+
+// Start batches the records read from in. A batch is written when it holds
+// BatchSize records, and at least every FlushInterval.
 func (o *Output) Start(in edge.Edge, _ edge.Edge) error {
 	ctx, cancel := context.WithCancel(context.Background())
 	o.cancel = cancel
-	o.wg.Add(1)
+	o.wg.Add(2)
+	go o.probe(ctx)
 	go func() {
 		defer o.wg.Done()
+		ticker := time.NewTicker(time.Duration(o.FlushInterval))
+		defer ticker.Stop()
+		batch := make([]*edge.Record, 0, o.BatchSize)
 		for {
 			select {
 			case <-ctx.Done():
+				// the records read so far are owned by the output
+				o.write(context.Background(), batch)
 				return
 			case record := <-in.Out():
-				rec, ok := record.(*edge.KafkaRecord)
-				if ok {
-					o.writeApis[0].WriteRecord(string(rec.Message.Value))
-					o.kafkaRecordPool.Put(rec)
+				metrics.NodeRecords.WithLabelValues(o.AliasOr(o.Name()), metrics.In).Inc()
+				batch = append(batch, record)
+				if len(batch) < o.BatchSize {
+					continue
 				}
+			case <-ticker.C:
 			}
+			o.write(ctx, batch)
+			batch = batch[:0]
 		}
 	}()
 	return nil
 }
 
+// write sends the batch, one request per target, and reports the result to
+// every record of it, the offsets are committed only for records that were
+// written.
+func (o *Output) write(ctx context.Context, batch []*edge.Record) {
+	type group struct {
+		records []*edge.Record
+		lines   [][]byte
+	}
+	var targets []target
+	groups := make(map[target]*group, 1)
+	for _, rec := range batch {
+		line, err := rec.LineProtocol()
+		if err != nil {
+			metrics.NodeRecords.WithLabelValues(o.AliasOr(o.Name()), metrics.Dropped).Inc()
+			rec.Nack(edge.Permanent(edge.WithStage(o.Name(), fmt.Errorf("encode record: %v", err))))
+			continue
+		}
+		t := o.target(rec)
+		g, ok := groups[t]
+		if !ok {
+			g = &group{}
+			groups[t] = g
+			targets = append(targets, t)
+		}
+		g.records = append(g.records, rec)
+		g.lines = append(g.lines, line)
+	}
+	for _, t := range targets {
+		o.writeRecords(ctx, t, groups[t].records, groups[t].lines)
+	}
+}
+
+// writeRecords writes the lines of records and reports the result to each
+// of them. A batch the server rejects as a bad request is split in halves
+// that are written again, so that only the offending records are nacked,
+// with a permanent error, and the others are acked.
+func (o *Output) writeRecords(ctx context.Context, t target, records []*edge.Record, lines [][]byte) {
+	start := time.Now()
+	err := o.send(ctx, t, bytes.Join(lines, []byte{'\n'}))
+	metrics.OutputWriteDuration.WithLabelValues(o.Name()).Observe(time.Since(start).Seconds())
+	if err != nil {
+		metrics.OutputWriteErrors.WithLabelValues(o.Name()).Inc()
+	}
+	if err != nil && edge.IsPermanent(err) && len(records) > 1 {
+		mid := len(records) / 2
+		o.writeRecords(ctx, t, records[:mid], lines[:mid])
+		o.writeRecords(ctx, t, records[mid:], lines[mid:])
+		return
+	}
+	if err != nil {
+		o.log.Error("write batch fail", zap.Int("records", len(records)),
+			zap.Duration("duration", time.Since(start)), zap.Error(err))
+	}
+	if err != nil {
+		metrics.NodeRecords.WithLabelValues(o.AliasOr(o.Name()), metrics.Dropped).Add(float64(len(records)))
+	} else {
+		metrics.NodeRecords.WithLabelValues(o.AliasOr(o.Name()), metrics.Out).Add(float64(len(records)))
+	}
+	for _, rec := range records {
+		if err != nil {
+			rec.Nack(edge.WithStage(o.Name(), err))
+		} else {
+			rec.Ack()
+		}
+	}
+}
+
+// send writes body to t, retrying up to MaxRetries times unless the error is
+// permanent or ctx is done. A url that fails is taken out of rotation and
+// the retry goes to the next one at once, the retry waits RetryBackoff only
+// when no url is left. A request in progress is not cancelled by ctx, it is
+// bounded by Timeout.
+func (o *Output) send(ctx context.Context, t target, body []byte) error {
+	for attempt := 0; ; attempt++ {
+		e := o.balancer.pick()
+		err := o.post(e.writeURL(t), body)
+		if err == nil || edge.IsPermanent(err) {
+			return err
+		}
+		if o.balancer.markDown(e) {
+			o.log.Warn("url out of rotation", zap.String("host", e.host), zap.Error(err))
+		}
+		if attempt >= o.MaxRetries {
+			return err
+		}
+		o.log.Warn("write batch fail, retry", zap.Int("attempt", attempt+1), zap.Error(err))
+		if o.balancer.available() {
+			continue
+		}
+		select {
+		case <-time.After(time.Duration(o.RetryBackoff)):
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
+
+// probe pings every url once, taking the ones that do not answer out of
+// rotation, so that Check does not report them reachable before any write.
+// It then pings the urls out of rotation every HealthCheckInterval and puts
+// them back once they answer.
+func (o *Output) probe(ctx context.Context) {
+	defer o.wg.Done()
+	for _, e := range o.balancer.endpoints {
+		if err := o.ping(e); err != nil && o.balancer.markDown(e) {
+			o.log.Warn("url out of rotation", zap.String("host", e.host), zap.Error(err))
+		}
+	}
+	atomic.StoreInt32(&o.probed, 1)
+
+	ticker := time.NewTicker(time.Duration(o.HealthCheckInterval))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		for _, e := range o.balancer.down() {
+			if err := o.ping(e); err != nil {
+				continue
+			}
+			if o.balancer.markUp(e) {
+				o.log.Info("url back in rotation", zap.String("host", e.host))
+			}
+		}
+	}
+}
+
+func (o *Output) ping(e *endpoint) error {
+	resp, err := o.client.Get(e.pingURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("ping %s: %s", e.host, resp.Status)
+	}
+	return nil
+}
+
+// post sends body to the write endpoint u. A bad request is a permanent
+// error, writing the same lines again fails the same way.
+func (o *Output) post(u string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if o.Username != "" || o.Password != "" {
+		req.SetBasicAuth(o.Username, o.Password)
+	}
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 == 2 {
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		return nil
+	}
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	err = fmt.Errorf("write %s: %s: %s", req.URL.Host, resp.Status, bytes.TrimSpace(msg))
+	if resp.StatusCode == http.StatusBadRequest {
+		return edge.Permanent(err)
+	}
+	return err
+}
+
 func init() {
 	outputs.Add("openGemini", func() node.Node {
-		return &Output{}
+		// 0 disables the retries, so the default is set before decoding
+		return &Output{OpenGemini: OpenGemini{MaxRetries: defaultMaxRetries}}
 	})
 }
@@ -0,0 +1,338 @@
+/*
+Copyright 2022 Huawei Cloud Computing Technologies Co., Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openGemini_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	itoml "github.com/influxdata/influxdb/toml"
+	"github.com/openGemini/openGemini-forwarder/edge"
+	"github.com/openGemini/openGemini-forwarder/lib/logger"
+	"github.com/openGemini/openGemini-forwarder/plugins/outputs/openGemini"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func init() {
+	logger.SetLogger(zap.NewNop())
+}
+
+// server records the write requests and answers them with the status
+// returned by respond, pings are answered with ping.
+type server struct {
+	*httptest.Server
+	mu      sync.Mutex
+	bodies  []string
+	queries []string
+	ping    int
+}
+
+func newServer(respond func(n int, body string) int) *server {
+	s := &server{ping: http.StatusNoContent}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/ping" {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			w.WriteHeader(s.ping)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		s.mu.Lock()
+		s.bodies = append(s.bodies, string(body))
+		s.queries = append(s.queries, r.URL.Path+"?"+r.URL.RawQuery)
+		n := len(s.bodies)
+		s.mu.Unlock()
+		w.WriteHeader(respond(n, string(body)))
+	}))
+	return s
+}
+
+func (s *server) requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.bodies...)
+}
+
+func newOutput(t *testing.T, s *server, o *openGemini.Output) bool {
+	o.URLs = []string{s.URL}
+	if o.RetryBackoff == 0 {
+		o.RetryBackoff = itoml.Duration(time.Millisecond)
+	}
+	return assert.NoError(t, o.Init())
+}
+
+// send writes records with the payloads to the output, stops it once they
+// are read and returns the error each of them was done with.
+func send(t *testing.T, o *openGemini.Output, payloads ...string) []error {
+	records := make([]*edge.Record, 0, len(payloads))
+	for _, payload := range payloads {
+		records = append(records, &edge.Record{Payload: []byte(payload)})
+	}
+	return sendRecords(t, o, records...)
+}
+
+func sendRecords(t *testing.T, o *openGemini.Output, records ...*edge.Record) []error {
+	in := edge.NewEdge("test", len(records))
+	errs := make([]error, len(records))
+	var wg sync.WaitGroup
+	for i, record := range records {
+		i := i
+		wg.Add(1)
+		record.Done = func(_ *edge.Record, err error) {
+			errs[i] = err
+			wg.Done()
+		}
+		in.In() <- record
+	}
+
+	if !assert.NoError(t, o.Start(in, nil)) {
+		return nil
+	}
+	for in.Len() > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	assert.NoError(t, o.Stop())
+	wg.Wait()
+	return errs
+}
+
+func TestOutputBatch(t *testing.T) {
+	s := newServer(func(int, string) int { return http.StatusNoContent })
+	defer s.Close()
+
+	o := &openGemini.Output{}
+	o.Database = "db"
+	o.RetentionPolicy = "rp"
+	o.BatchSize = 2
+	o.FlushInterval = itoml.Duration(time.Hour)
+	if !newOutput(t, s, o) {
+		return
+	}
+
+	errs := send(t, o, "m v=1", "m v=2", "m v=3")
+	assert.Equal(t, []error{nil, nil, nil}, errs)
+	// the last record is written when the output stops
+	assert.Equal(t, []string{"m v=1\nm v=2", "m v=3"}, s.requests())
+	assert.Equal(t, "/write?db=db&precision=ns&rp=rp", s.queries[0])
+}
+
+func TestOutputDatabaseHeader(t *testing.T) {
+	s := newServer(func(int, string) int { return http.StatusNoContent })
+	defer s.Close()
+
+	o := &openGemini.Output{}
+	o.Database = "db"
+	o.DatabaseHeader = "db"
+	o.RetentionPolicyHeader = "rp"
+	o.FlushInterval = itoml.Duration(time.Hour)
+	if !newOutput(t, s, o) {
+		return
+	}
+
+	errs := sendRecords(t, o,
+		&edge.Record{Payload: []byte("m v=1")},
+		&edge.Record{Payload: []byte("m v=2"), Source: edge.Source{Headers: map[string]string{"db": "a", "rp": "week"}}},
+		&edge.Record{Payload: []byte("m v=3"), Source: edge.Source{Headers: map[string]string{"rp": ""}}})
+	assert.Equal(t, []error{nil, nil, nil}, errs)
+	assert.Equal(t, []string{"m v=1\nm v=3", "m v=2"}, s.requests())
+	assert.Equal(t, []string{"/write?db=db&precision=ns", "/write?db=a&precision=ns&rp=week"}, s.queries)
+}
+
+func TestOutputFlushInterval(t *testing.T) {
+	s := newServer(func(int, string) int { return http.StatusNoContent })
+	defer s.Close()
+
+	o := &openGemini.Output{}
+	o.FlushInterval = itoml.Duration(time.Millisecond)
+	if !newOutput(t, s, o) {
+		return
+	}
+
+	in := edge.NewEdge("test", 1)
+	done := make(chan error, 1)
+	assert.NoError(t, o.Start(in, nil))
+	in.In() <- &edge.Record{Payload: []byte("m v=1"), Done: func(_ *edge.Record, err error) {
+		done <- err
+	}}
+	assert.NoError(t, <-done)
+	assert.NoError(t, o.Stop())
+}
+
+func TestOutputRetry(t *testing.T) {
+	s := newServer(func(n int, _ string) int {
+		if n <= 2 {
+			return http.StatusServiceUnavailable
+		}
+		return http.StatusNoContent
+	})
+	defer s.Close()
+
+	o := &openGemini.Output{}
+	o.MaxRetries = 2
+	if !newOutput(t, s, o) {
+		return
+	}
+
+	errs := send(t, o, "m v=1")
+	assert.NoError(t, errs[0])
+	assert.Equal(t, 3, len(s.requests()))
+
+	o.MaxRetries = 0
+	s.mu.Lock()
+	s.bodies = nil
+	s.mu.Unlock()
+	errs = send(t, o, "m v=1")
+	if assert.Error(t, errs[0]) {
+		assert.False(t, edge.IsPermanent(errs[0]))
+	}
+	assert.Equal(t, 1, len(s.requests()))
+}
+
+func TestOutputBadRequest(t *testing.T) {
+	s := newServer(func(_ int, body string) int {
+		if strings.Contains(body, "bad") {
+			return http.StatusBadRequest
+		}
+		return http.StatusNoContent
+	})
+	defer s.Close()
+
+	o := &openGemini.Output{}
+	o.MaxRetries = 3
+	if !newOutput(t, s, o) {
+		return
+	}
+
+	errs := send(t, o, "m v=1", "m v=2", "bad v=3", "m v=4")
+	assert.NoError(t, errs[0])
+	assert.NoError(t, errs[1])
+	assert.True(t, edge.IsPermanent(errs[2]))
+	assert.NoError(t, errs[3])
+	// the batch, its halves and the quarters of the bad half, without retry
+	assert.Equal(t, 5, len(s.requests()))
+}
+
+func TestOutputRoundRobin(t *testing.T) {
+	ok := func(int, string) int { return http.StatusNoContent }
+	s1, s2 := newServer(ok), newServer(ok)
+	defer s1.Close()
+	defer s2.Close()
+
+	o := &openGemini.Output{}
+	o.URLs = []string{s1.URL, s2.URL}
+	o.BatchSize = 1
+	if !assert.NoError(t, o.Init()) {
+		return
+	}
+
+	errs := send(t, o, "m v=1", "m v=2", "m v=3", "m v=4")
+	assert.Equal(t, []error{nil, nil, nil, nil}, errs)
+	assert.Equal(t, 2, len(s1.requests()))
+	assert.Equal(t, 2, len(s2.requests()))
+}
+
+func TestOutputFailover(t *testing.T) {
+	var mu sync.Mutex
+	status := http.StatusServiceUnavailable
+	primary := newServer(func(int, string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return status
+	})
+	primary.ping = http.StatusServiceUnavailable
+	secondary := newServer(func(int, string) int { return http.StatusNoContent })
+	defer primary.Close()
+	defer secondary.Close()
+
+	o := &openGemini.Output{}
+	o.URLs = []string{primary.URL, secondary.URL}
+	o.WriteStrategy = "failover"
+	o.BatchSize = 1
+	o.MaxRetries = 1
+	o.RetryBackoff = itoml.Duration(time.Hour)
+	o.HealthCheckInterval = itoml.Duration(time.Millisecond)
+	if !assert.NoError(t, o.Init()) {
+		return
+	}
+
+	// the primary fails once and is skipped until it answers pings
+	errs := send(t, o, "m v=1", "m v=2")
+	assert.Equal(t, []error{nil, nil}, errs)
+	assert.Equal(t, 1, len(primary.requests()))
+	assert.Equal(t, 2, len(secondary.requests()))
+
+	mu.Lock()
+	status = http.StatusNoContent
+	mu.Unlock()
+	primary.mu.Lock()
+	primary.ping = http.StatusNoContent
+	primary.mu.Unlock()
+
+	in := edge.NewEdge("test", 1)
+	assert.NoError(t, o.Start(in, nil))
+	deadline := time.Now().Add(5 * time.Second)
+	for len(primary.requests()) < 2 && time.Now().Before(deadline) {
+		done := make(chan struct{})
+		in.In() <- &edge.Record{Payload: []byte("m v=3"), Done: func(*edge.Record, error) { close(done) }}
+		<-done
+	}
+	assert.NoError(t, o.Stop())
+	assert.Equal(t, 2, len(primary.requests()))
+}
+
+func TestOutputCheck(t *testing.T) {
+	s := newServer(func(int, string) int { return http.StatusNoContent })
+	defer s.Close()
+	s.ping = http.StatusServiceUnavailable
+
+	o := &openGemini.Output{}
+	o.URLs = []string{s.URL}
+	o.HealthCheckInterval = itoml.Duration(time.Hour)
+	if !assert.NoError(t, o.Init()) {
+		return
+	}
+	assert.EqualError(t, o.Check(), "urls not probed yet")
+	assert.NoError(t, o.Start(edge.NewEdge("test", 1), nil))
+	defer o.Stop()
+	deadline := time.Now().Add(5 * time.Second)
+	err := o.Check()
+	for err != nil && err.Error() == "urls not probed yet" && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+		err = o.Check()
+	}
+	assert.EqualError(t, err, "no url is reachable")
+}
+
+func TestOutputInit(t *testing.T) {
+	o := &openGemini.Output{}
+	o.URLs = []string{"udp://127.0.0.1:8089"}
+	assert.Error(t, o.Init())
+
+	o = &openGemini.Output{}
+	o.MaxRetries = -1
+	assert.Error(t, o.Init())
+
+	o = &openGemini.Output{}
+	o.WriteStrategy = "fastest"
+	assert.Error(t, o.Init())
+}
@@ -0,0 +1,359 @@
+/*
+Copyright 2022 Huawei Cloud Computing Technologies Co., Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package json
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/openGemini/openGemini-forwarder/dag/node"
+	"github.com/openGemini/openGemini-forwarder/edge"
+	"github.com/openGemini/openGemini-forwarder/lib/logger"
+	"github.com/openGemini/openGemini-forwarder/plugins/parsers"
+	"go.uber.org/zap"
+)
+
+//go:embed sample.conf
+var sampleConfig string
+
+const (
+	defaultMeasurementName = "json"
+	defaultSeparator       = "_"
+
+	// numeric time formats, any other format is a Go time layout
+	timeFormatUnix   = "unix"
+	timeFormatUnixMs = "unix_ms"
+	timeFormatUnixUs = "unix_us"
+	timeFormatUnixNs = "unix_ns"
+)
+
+// reservedKey cannot be a tag or field key in openGemini.
+const reservedKey = "time"
+
+var timeUnits = map[string]time.Duration{
+	timeFormatUnix:   time.Second,
+	timeFormatUnixMs: time.Millisecond,
+	timeFormatUnixUs: time.Microsecond,
+	timeFormatUnixNs: time.Nanosecond,
+}
+
+// Parser turns a JSON object, or an array of objects, into one point per
+// object. Nested objects and arrays are flattened, their keys are joined
+// with Separator, so "tags" and "fields" refer to the flattened keys.
+type Parser struct {
+	node.Alias
+
+	// MeasurementName is the measurement of the points whose object does
+	// not have MeasurementKey.
+	MeasurementName string `toml:"measurement_name"`
+	// MeasurementKey is the key holding the measurement name.
+	MeasurementKey string `toml:"measurement_key"`
+	// TagKeys are the keys stored as tags.
+	TagKeys []string `toml:"tag_keys"`
+	// FieldKeys are the keys stored as fields, all numbers and booleans that
+	// are not tags are fields if empty.
+	FieldKeys []string `toml:"field_keys"`
+	// TimeKey is the key holding the timestamp, in TimeFormat.
+	TimeKey string `toml:"time_key"`
+	// TimeFormat is one of "unix", "unix_ms", "unix_us", "unix_ns" or a Go
+	// time layout.
+	TimeFormat string `toml:"time_format"`
+	// DefaultTimestamp is the timestamp of objects without TimeKey.
+	DefaultTimestamp parsers.DefaultTimestamp `toml:"default_timestamp"`
+	// Separator joins the keys of nested objects and array indexes.
+	Separator string `toml:"separator"`
+
+	tags   map[string]bool
+	fields map[string]bool
+	log    *logger.Logger
+	loop   parsers.Loop
+}
+
+func (p *Parser) Name() string {
+	return "json"
+}
+
+func (*Parser) SampleConfig() string {
+	return sampleConfig
+}
+
+// Validate validates that the configuration is acceptable.
+func (p *Parser) Validate() error {
+	if p.TimeKey != "" && p.TimeFormat == "" {
+		return errors.New("time_format is required with time_key")
+	}
+
+	if err := p.DefaultTimestamp.Check(); err != nil {
+		return err
+	}
+
+	tags := make(map[string]bool, len(p.TagKeys))
+	for _, k := range p.TagKeys {
+		tags[k] = true
+	}
+	for _, k := range p.FieldKeys {
+		if tags[k] {
+			return fmt.Errorf("key %q is both a tag and a field", k)
+		}
+	}
+	return nil
+}
+
+func (p *Parser) Init() error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	if p.MeasurementName == "" {
+		p.MeasurementName = defaultMeasurementName
+	}
+	if p.Separator == "" {
+		p.Separator = defaultSeparator
+	}
+
+	p.tags = make(map[string]bool, len(p.TagKeys))
+	for _, k := range p.TagKeys {
+		p.tags[k] = true
+	}
+	p.fields = make(map[string]bool, len(p.FieldKeys))
+	for _, k := range p.FieldKeys {
+		p.fields[k] = true
+	}
+
+	p.log = logger.NewLogger(p.Name())
+	return nil
+}
+
+func (p *Parser) Start(in edge.Edge, out edge.Edge) error {
+	p.loop.Start(p.AliasOr(p.Name()), in, out, p.Parse)
+	return nil
+}
+
+func (p *Parser) Stop() error {
+	p.loop.Stop()
+	return nil
+}
+
+// SetRejected sets the func the invalid objects of the records that partly
+// parse are handed to.
+func (p *Parser) SetRejected(fn func(r *edge.Record, err error)) {
+	p.loop.SetRejected(fn)
+}
+
+// Parse sets the points of record from its payload. Invalid objects are
+// logged and rejected as a JSON array, an error is returned if no object
+// is valid.
+func (p *Parser) Parse(record *edge.Record) error {
+	dec := json.NewDecoder(bytes.NewReader(record.Payload))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return fmt.Errorf("invalid json: %v", err)
+	}
+
+	var elements []interface{}
+	switch v := doc.(type) {
+	case map[string]interface{}:
+		elements = append(elements, v)
+	case []interface{}:
+		elements = v
+	default:
+		return errors.New("json is neither an object nor an array")
+	}
+
+	defaultTime := p.DefaultTimestamp.Time(record)
+	points := make([]edge.Point, 0, len(elements))
+	var invalid []interface{}
+	var invalidErr error
+	for i, item := range elements {
+		var pt edge.Point
+		var err error
+		obj, ok := item.(map[string]interface{})
+		if !ok {
+			err = fmt.Errorf("element %d is not an object", i)
+		} else if pt, err = p.point(obj, defaultTime); err != nil {
+			err = fmt.Errorf("element %d: %v", i, err)
+		}
+		if err != nil {
+			p.logInvalid(record, err)
+			invalid = append(invalid, item)
+			if invalidErr == nil {
+				invalidErr = err
+			}
+			continue
+		}
+		points = append(points, pt)
+	}
+	if len(points) == 0 {
+		return errors.New("no points")
+	}
+	if len(invalid) > 0 {
+		payload, err := json.Marshal(invalid)
+		if err != nil {
+			payload = record.Payload
+		}
+		p.loop.Reject(record, payload, invalidErr)
+	}
+	record.Points = points
+	return nil
+}
+
+func (p *Parser) logInvalid(record *edge.Record, err error) {
+	src := record.Source
+	p.log.Error("invalid json object",
+		zap.String("topic", src.Topic), zap.Int32("partition", src.Partition),
+		zap.Int64("offset", src.Offset), zap.Error(err))
+}
+
+// point converts one object, it fails if the object has no field or would
+// be rejected by the database.
+func (p *Parser) point(obj map[string]interface{}, defaultTime time.Time) (edge.Point, error) {
+	flat := make(map[string]interface{}, len(obj))
+	p.flatten("", obj, flat)
+
+	pt := edge.Point{
+		Measurement: p.MeasurementName,
+		Tags:        make(map[string]string),
+		Fields:      make(map[string]interface{}),
+		Time:        defaultTime,
+	}
+	if p.MeasurementKey != "" {
+		if v, ok := flat[p.MeasurementKey]; ok {
+			pt.Measurement = toString(v)
+			delete(flat, p.MeasurementKey)
+		}
+	}
+	if pt.Measurement == "" {
+		return pt, errors.New("empty measurement")
+	}
+	if p.TimeKey != "" {
+		v, ok := flat[p.TimeKey]
+		if !ok {
+			return pt, fmt.Errorf("missing time key %q", p.TimeKey)
+		}
+		t, err := p.parseTime(v)
+		if err != nil {
+			return pt, err
+		}
+		pt.Time = t
+		delete(flat, p.TimeKey)
+	}
+
+	for k, v := range flat {
+		if k == reservedKey {
+			return pt, fmt.Errorf("key %q is reserved, set time_key to use it as the timestamp", k)
+		}
+		switch {
+		case p.tags[k]:
+			pt.Tags[k] = toString(v)
+		case len(p.fields) > 0:
+			if p.fields[k] {
+				pt.Fields[k] = toField(v)
+			}
+		default:
+			switch v.(type) {
+			case json.Number, bool:
+				pt.Fields[k] = toField(v)
+			}
+		}
+	}
+	if len(pt.Fields) == 0 {
+		return pt, errors.New("no fields")
+	}
+	return pt, nil
+}
+
+// flatten copies the scalar values of v to dst, keyed by their path.
+func (p *Parser) flatten(prefix string, v interface{}, dst map[string]interface{}) {
+	join := func(key string) string {
+		if prefix == "" {
+			return key
+		}
+		return prefix + p.Separator + key
+	}
+
+	switch vv := v.(type) {
+	case map[string]interface{}:
+		for k, item := range vv {
+			p.flatten(join(k), item, dst)
+		}
+	case []interface{}:
+		for i, item := range vv {
+			p.flatten(join(strconv.Itoa(i)), item, dst)
+		}
+	case nil:
+	default:
+		dst[prefix] = vv
+	}
+}
+
+func (p *Parser) parseTime(v interface{}) (time.Time, error) {
+	if unit, ok := timeUnits[p.TimeFormat]; ok {
+		// numeric times may also be quoted
+		n := json.Number(toString(v))
+		if i, err := n.Int64(); err == nil {
+			return time.Unix(0, i*int64(unit)).UTC(), nil
+		}
+		f, err := n.Float64()
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid %s time %q", p.TimeFormat, n)
+		}
+		return time.Unix(0, int64(f*float64(unit))).UTC(), nil
+	}
+
+	s, ok := v.(string)
+	if !ok {
+		return time.Time{}, fmt.Errorf("time %v is not a string", v)
+	}
+	t, err := time.Parse(p.TimeFormat, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q: %v", s, err)
+	}
+	return t, nil
+}
+
+// toField converts numbers to float64, other values are kept.
+func toField(v interface{}) interface{} {
+	if n, ok := v.(json.Number); ok {
+		if f, err := n.Float64(); err == nil {
+			return f
+		}
+		return n.String()
+	}
+	return v
+}
+
+func toString(v interface{}) string {
+	switch vv := v.(type) {
+	case string:
+		return vv
+	case json.Number:
+		return vv.String()
+	default:
+		return fmt.Sprint(vv)
+	}
+}
+
+func init() {
+	parsers.Add("json", func() node.Node {
+		return &Parser{}
+	})
+}
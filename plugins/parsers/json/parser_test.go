@@ -0,0 +1,112 @@
+/*
+Copyright 2022 Huawei Cloud Computing Technologies Co., Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package json_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/openGemini/openGemini-forwarder/edge"
+	"github.com/openGemini/openGemini-forwarder/lib/logger"
+	"github.com/openGemini/openGemini-forwarder/plugins/parsers/json"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func init() {
+	logger.SetLogger(zap.NewNop())
+}
+
+func TestParser(t *testing.T) {
+	p := &json.Parser{
+		MeasurementKey: "name",
+		TagKeys:        []string{"host", "labels_dc"},
+		TimeKey:        "ts",
+		TimeFormat:     "unix_ms",
+	}
+	if !assert.NoError(t, p.Init()) {
+		return
+	}
+	var rejected *edge.Record
+	var rejectedErr error
+	p.SetRejected(func(r *edge.Record, err error) {
+		rejected, rejectedErr = r, err
+	})
+
+	record := &edge.Record{Payload: []byte(`[
+		{"name": "cpu", "host": "h1", "labels": {"dc": "a"}, "usage": 1.5, "idle": 98, "ok": true, "msg": "x", "ts": 10000},
+		"invalid",
+		{"host": "h2", "values": [1, 2], "ts": "20000"},
+		{"name": "mem", "ts": 30000},
+		{"name": "", "v": 1, "ts": 40000},
+		{"name": "disk", "time": 5, "v": 1, "ts": 50000}
+	]`)}
+	assert.NoError(t, p.Parse(record))
+	assert.Equal(t, []edge.Point{
+		{
+			Measurement: "cpu",
+			Tags:        map[string]string{"host": "h1", "labels_dc": "a"},
+			Fields:      map[string]interface{}{"usage": 1.5, "idle": 98.0, "ok": true},
+			Time:        time.Unix(10, 0).UTC(),
+		},
+		{
+			Measurement: "json",
+			Tags:        map[string]string{"host": "h2"},
+			Fields:      map[string]interface{}{"values_0": 1.0, "values_1": 2.0},
+			Time:        time.Unix(20, 0).UTC(),
+		},
+	}, record.Points)
+	if assert.NotNil(t, rejected) {
+		assert.JSONEq(t, `["invalid", {"name": "mem", "ts": 30000}, {"name": "", "v": 1, "ts": 40000},
+			{"name": "disk", "time": 5, "v": 1, "ts": 50000}]`, string(rejected.Payload))
+		assert.True(t, edge.IsPermanent(rejectedErr))
+	}
+
+	assert.Error(t, p.Parse(&edge.Record{Payload: []byte(`{"name": "cpu"`)}))
+	assert.Error(t, p.Parse(&edge.Record{Payload: []byte(`"cpu"`)}))
+}
+
+func TestParserFieldKeys(t *testing.T) {
+	p := &json.Parser{
+		MeasurementName:  "event",
+		FieldKeys:        []string{"msg", "code"},
+		TimeKey:          "time",
+		TimeFormat:       time.RFC3339,
+		DefaultTimestamp: "source",
+		Separator:        ".",
+	}
+	if !assert.NoError(t, p.Init()) {
+		return
+	}
+
+	record := &edge.Record{Payload: []byte(`{"msg": "started", "code": 3, "other": 1, "time": "2022-01-02T03:04:05Z"}`)}
+	assert.NoError(t, p.Parse(record))
+	assert.Equal(t, []edge.Point{{
+		Measurement: "event",
+		Tags:        map[string]string{},
+		Fields:      map[string]interface{}{"msg": "started", "code": 3.0},
+		Time:        time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC),
+	}}, record.Points)
+
+	assert.Error(t, p.Parse(&edge.Record{Payload: []byte(`{"msg": "started", "time": "yesterday"}`)}))
+}
+
+func TestParserInit(t *testing.T) {
+	assert.Error(t, (&json.Parser{TimeKey: "ts"}).Init())
+	assert.Error(t, (&json.Parser{DefaultTimestamp: "later"}).Init())
+	assert.Error(t, (&json.Parser{TagKeys: []string{"a"}, FieldKeys: []string{"a"}}).Init())
+}
@@ -0,0 +1,160 @@
+/*
+Copyright 2022 Huawei Cloud Computing Technologies Co., Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lineprotocol
+
+import (
+	"bytes"
+	_ "embed"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/influxdata/influxdb/models"
+	"github.com/openGemini/openGemini-forwarder/dag/node"
+	"github.com/openGemini/openGemini-forwarder/edge"
+	"github.com/openGemini/openGemini-forwarder/lib/logger"
+	"github.com/openGemini/openGemini-forwarder/plugins/parsers"
+	"go.uber.org/zap"
+)
+
+//go:embed sample.conf
+var sampleConfig string
+
+var precisions = map[string]string{
+	"":   "n",
+	"ns": "n",
+	"us": "u",
+	"ms": "ms",
+	"s":  "s",
+}
+
+type Parser struct {
+	node.Alias
+
+	// Precision of the timestamps in the lines, one of "ns", "us", "ms" or "s".
+	Precision string `toml:"precision"`
+	// DefaultTimestamp is the timestamp of lines without one.
+	DefaultTimestamp parsers.DefaultTimestamp `toml:"default_timestamp"`
+	// DefaultTags are added to the points that do not have them.
+	DefaultTags map[string]string `toml:"default_tags"`
+
+	precision string
+	log       *logger.Logger
+	loop      parsers.Loop
+}
+
+func (p *Parser) Name() string {
+	return "line_protocol"
+}
+
+func (*Parser) SampleConfig() string {
+	return sampleConfig
+}
+
+// Validate validates that the configuration is acceptable.
+func (p *Parser) Validate() error {
+	if _, ok := precisions[p.Precision]; !ok {
+		return fmt.Errorf("invalid precision %q", p.Precision)
+	}
+	return p.DefaultTimestamp.Check()
+}
+
+func (p *Parser) Init() error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	p.precision = precisions[p.Precision]
+	p.log = logger.NewLogger(p.Name())
+	return nil
+}
+
+func (p *Parser) Start(in edge.Edge, out edge.Edge) error {
+	p.loop.Start(p.AliasOr(p.Name()), in, out, p.Parse)
+	return nil
+}
+
+func (p *Parser) Stop() error {
+	p.loop.Stop()
+	return nil
+}
+
+// SetRejected sets the func the invalid lines of the records that partly
+// parse are handed to.
+func (p *Parser) SetRejected(fn func(r *edge.Record, err error)) {
+	p.loop.SetRejected(fn)
+}
+
+// Parse sets the points of record from its payload. Invalid lines are
+// logged and rejected, an error is returned if no line is valid.
+func (p *Parser) Parse(record *edge.Record) error {
+	defaultTime := p.DefaultTimestamp.Time(record)
+	points, err := models.ParsePointsWithPrecision(record.Payload, defaultTime, p.precision)
+	if err != nil {
+		src := record.Source
+		p.log.Error("invalid line protocol",
+			zap.String("topic", src.Topic), zap.Int32("partition", src.Partition),
+			zap.Int64("offset", src.Offset), zap.Error(err))
+	}
+	if len(points) == 0 {
+		if err == nil {
+			err = errors.New("no points")
+		}
+		return err
+	}
+	if err != nil {
+		p.loop.Reject(record, p.invalidLines(record.Payload, defaultTime), err)
+	}
+
+	record.Points = make([]edge.Point, 0, len(points))
+	for _, pt := range points {
+		fields, err := pt.Fields()
+		if err != nil {
+			return err
+		}
+		tags := pt.Tags().Map()
+		for k, v := range p.DefaultTags {
+			if _, ok := tags[k]; !ok {
+				tags[k] = v
+			}
+		}
+		record.Points = append(record.Points, edge.Point{
+			Measurement: string(pt.Name()),
+			Tags:        tags,
+			Fields:      fields,
+			Time:        pt.Time(),
+		})
+	}
+	return nil
+}
+
+// invalidLines returns the lines of payload that do not parse.
+func (p *Parser) invalidLines(payload []byte, defaultTime time.Time) []byte {
+	var invalid []byte
+	for _, line := range bytes.Split(payload, []byte("\n")) {
+		if _, err := models.ParsePointsWithPrecision(line, defaultTime, p.precision); err != nil {
+			invalid = append(invalid, line...)
+			invalid = append(invalid, '\n')
+		}
+	}
+	return invalid
+}
+
+func init() {
+	parsers.Add("line_protocol", func() node.Node {
+		return &Parser{}
+	})
+}
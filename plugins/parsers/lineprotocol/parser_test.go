@@ -0,0 +1,120 @@
+/*
+Copyright 2022 Huawei Cloud Computing Technologies Co., Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lineprotocol_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/openGemini/openGemini-forwarder/edge"
+	"github.com/openGemini/openGemini-forwarder/lib/logger"
+	"github.com/openGemini/openGemini-forwarder/plugins/parsers/lineprotocol"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func init() {
+	logger.SetLogger(zap.NewNop())
+}
+
+func TestParser(t *testing.T) {
+	p := &lineprotocol.Parser{
+		Precision:        "s",
+		DefaultTimestamp: "source",
+		DefaultTags:      map[string]string{"dc": "a", "host": "default"},
+	}
+	if !assert.NoError(t, p.Init()) {
+		return
+	}
+
+	ts := time.Unix(100, 0).UTC()
+	record := &edge.Record{
+		Payload: []byte("cpu,host=h1 usage=1 10\ninvalid line\nmem free=2i"),
+		Source:  edge.Source{Timestamp: ts},
+	}
+	assert.NoError(t, p.Parse(record))
+	assert.Equal(t, []edge.Point{
+		{
+			Measurement: "cpu",
+			Tags:        map[string]string{"host": "h1", "dc": "a"},
+			Fields:      map[string]interface{}{"usage": 1.0},
+			Time:        time.Unix(10, 0).UTC(),
+		},
+		{
+			Measurement: "mem",
+			Tags:        map[string]string{"host": "default", "dc": "a"},
+			Fields:      map[string]interface{}{"free": int64(2)},
+			Time:        ts,
+		},
+	}, record.Points)
+
+	assert.Error(t, p.Parse(&edge.Record{Payload: []byte("invalid")}))
+}
+
+func TestParserSourceTags(t *testing.T) {
+	p := &lineprotocol.Parser{}
+	if !assert.NoError(t, p.Init()) {
+		return
+	}
+	in, out := edge.NewEdge("in", 1), edge.NewEdge("out", 1)
+	if !assert.NoError(t, p.Start(in, out)) {
+		return
+	}
+	defer p.Stop()
+
+	in.In() <- &edge.Record{
+		Payload: []byte("cpu,host=h1 usage=1 10"),
+		Source:  edge.Source{Tags: map[string]string{"host": "h2", "topic": "a/b"}},
+	}
+	record := <-out.Out()
+	if assert.Len(t, record.Points, 1) {
+		assert.Equal(t, map[string]string{"host": "h2", "topic": "a/b"}, record.Points[0].Tags)
+	}
+}
+
+func TestParserInit(t *testing.T) {
+	assert.Error(t, (&lineprotocol.Parser{Precision: "m"}).Init())
+	assert.Error(t, (&lineprotocol.Parser{DefaultTimestamp: "later"}).Init())
+}
+
+func TestParserRejected(t *testing.T) {
+	p := &lineprotocol.Parser{}
+	if !assert.NoError(t, p.Init()) {
+		return
+	}
+	var rejected *edge.Record
+	var rejectedErr error
+	p.SetRejected(func(r *edge.Record, err error) {
+		rejected, rejectedErr = r, err
+	})
+
+	record := &edge.Record{
+		Payload: []byte("cpu usage=1 10\ninvalid line\nmem free=2i 10\nbad"),
+		Source:  edge.Source{Topic: "t", Offset: 3},
+	}
+	assert.NoError(t, p.Parse(record))
+	assert.Len(t, record.Points, 2)
+	if assert.NotNil(t, rejected) {
+		assert.Equal(t, "invalid line\nbad\n", string(rejected.Payload))
+		assert.Equal(t, record.Source, rejected.Source)
+		assert.True(t, edge.IsPermanent(rejectedErr))
+	}
+
+	rejected = nil
+	assert.NoError(t, p.Parse(&edge.Record{Payload: []byte("cpu usage=1 10")}))
+	assert.Nil(t, rejected)
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2022 Huawei Cloud Computing Technologies Co., Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package parsers
+
+import (
+	"context"
+	"sync"
+
+	"github.com/openGemini/openGemini-forwarder/edge"
+	"github.com/openGemini/openGemini-forwarder/lib/metrics"
+)
+
+// Rejecter is implemented by the parsers that hand the invalid part of a
+// record that partly parses to a func, so that it can be written to the
+// dead letters.
+type Rejecter interface {
+	SetRejected(fn func(r *edge.Record, err error))
+}
+
+// Loop runs the parse function of a parser over the records of its input
+// edge. Records that do not parse are nacked with a permanent error tagged
+// with the stage, the others get the tags of their source on their points
+// and are written to the output edge. The records
+// are counted in the node metrics of the stage.
+type Loop struct {
+	wg     sync.WaitGroup
+	cancel context.CancelFunc
+
+	stage    string
+	mu       sync.Mutex
+	rejected func(r *edge.Record, err error)
+}
+
+// SetRejected sets the func Reject hands the invalid parts to.
+func (l *Loop) SetRejected(fn func(r *edge.Record, err error)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rejected = fn
+}
+
+// Reject hands payload, the invalid part of record, to the func set by
+// SetRejected as a record of the same source, failed with err made
+// permanent and tagged with the stage. It is counted as dropped if there
+// is no func.
+func (l *Loop) Reject(record *edge.Record, payload []byte, err error) {
+	l.mu.Lock()
+	fn := l.rejected
+	l.mu.Unlock()
+	if fn == nil {
+		metrics.NodeRecords.WithLabelValues(l.stage, metrics.Dropped).Inc()
+		return
+	}
+	rejected := &edge.Record{Payload: payload, Source: record.Source, Attempts: record.Attempts}
+	fn(rejected, edge.Permanent(edge.WithStage(l.stage, err)))
+}
+
+func (l *Loop) Start(stage string, in edge.Edge, out edge.Edge, parse func(*edge.Record) error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	l.cancel = cancel
+	l.stage = stage
+	received := metrics.NodeRecords.WithLabelValues(stage, metrics.In)
+	emitted := metrics.NodeRecords.WithLabelValues(stage, metrics.Out)
+	dropped := metrics.NodeRecords.WithLabelValues(stage, metrics.Dropped)
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case record := <-in.Out():
+				received.Inc()
+				if err := parse(record); err != nil {
+					dropped.Inc()
+					record.Nack(edge.Permanent(edge.WithStage(stage, err)))
+					continue
+				}
+				addSourceTags(record)
+				select {
+				case out.In() <- record:
+					emitted.Inc()
+				case <-ctx.Done():
+					record.Nack(edge.WithStage(stage, edge.ErrStopped))
+					return
+				}
+			}
+		}
+	}()
+}
+
+// Stop stops the loop, the record being parsed is nacked if it cannot be
+// written meanwhile.
+func (l *Loop) Stop() {
+	l.cancel()
+	l.wg.Wait()
+}
+
+func addSourceTags(record *edge.Record) {
+	if len(record.Source.Tags) == 0 {
+		return
+	}
+	for i := range record.Points {
+		p := &record.Points[i]
+		if p.Tags == nil {
+			p.Tags = make(map[string]string, len(record.Source.Tags))
+		}
+		for k, v := range record.Source.Tags {
+			p.Tags[k] = v
+		}
+	}
+}
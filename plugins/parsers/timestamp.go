@@ -0,0 +1,60 @@
+/*
+Copyright 2022 Huawei Cloud Computing Technologies Co., Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package parsers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/openGemini/openGemini-forwarder/edge"
+)
+
+const (
+	TimestampNone   = "none"
+	TimestampNow    = "now"
+	TimestampSource = "source"
+)
+
+// DefaultTimestamp is the timestamp of the points parsed without one, "none"
+// leaves it to the database, "now" uses the parse time and "source" uses the
+// time the input assigned to the message.
+type DefaultTimestamp string
+
+// Check validates t, it is "none" if empty.
+func (t *DefaultTimestamp) Check() error {
+	switch *t {
+	case "":
+		*t = TimestampNone
+	case TimestampNone, TimestampNow, TimestampSource:
+	default:
+		return fmt.Errorf("invalid default_timestamp %q", string(*t))
+	}
+	return nil
+}
+
+// Time returns the timestamp of the points of record parsed without one,
+// the zero time for "none".
+func (t DefaultTimestamp) Time(record *edge.Record) time.Time {
+	switch t {
+	case TimestampNow:
+		return time.Now()
+	case TimestampSource:
+		return record.Source.Timestamp
+	default:
+		return time.Time{}
+	}
+}
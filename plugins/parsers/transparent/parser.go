@@ -18,6 +18,7 @@ package transparent
 
 import (
 	"context"
+	_ "embed"
 	"sync"
 
 	"github.com/openGemini/openGemini-forwarder/dag/node"
@@ -25,6 +26,9 @@ import (
 	"github.com/openGemini/openGemini-forwarder/plugins/parsers"
 )
 
+//go:embed sample.conf
+var sampleConfig string
+
 type Parser struct {
 	wg     sync.WaitGroup
 	cancel context.CancelFunc
@@ -34,6 +38,10 @@ func (p *Parser) Name() string {
 	return "transparent"
 }
 
+func (*Parser) SampleConfig() string {
+	return sampleConfig
+}
+
 func (p *Parser) Init() error {
 	return nil
 }
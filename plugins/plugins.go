@@ -17,7 +17,18 @@ limitations under the License.
 package plugins
 
 import (
+	_ "github.com/openGemini/openGemini-forwarder/plugins/inputs/file"
+	_ "github.com/openGemini/openGemini-forwarder/plugins/inputs/httplistener"
 	_ "github.com/openGemini/openGemini-forwarder/plugins/inputs/kafka"
+	_ "github.com/openGemini/openGemini-forwarder/plugins/inputs/mqtt"
+	_ "github.com/openGemini/openGemini-forwarder/plugins/inputs/remotewrite"
+	_ "github.com/openGemini/openGemini-forwarder/plugins/outputs/kafka"
 	_ "github.com/openGemini/openGemini-forwarder/plugins/outputs/openGemini"
+	_ "github.com/openGemini/openGemini-forwarder/plugins/parsers/json"
+	_ "github.com/openGemini/openGemini-forwarder/plugins/parsers/lineprotocol"
 	_ "github.com/openGemini/openGemini-forwarder/plugins/parsers/transparent"
+	_ "github.com/openGemini/openGemini-forwarder/plugins/processors/addtags"
+	_ "github.com/openGemini/openGemini-forwarder/plugins/processors/convert"
+	_ "github.com/openGemini/openGemini-forwarder/plugins/processors/drop"
+	_ "github.com/openGemini/openGemini-forwarder/plugins/processors/rename"
 )
@@ -0,0 +1,95 @@
+/*
+Copyright 2022 Huawei Cloud Computing Technologies Co., Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package addtags
+
+import (
+	_ "embed"
+	"errors"
+
+	"github.com/openGemini/openGemini-forwarder/dag/node"
+	"github.com/openGemini/openGemini-forwarder/edge"
+	"github.com/openGemini/openGemini-forwarder/plugins/processors"
+)
+
+//go:embed sample.conf
+var sampleConfig string
+
+// Processor adds static tags to the points, the tags a point already has
+// are kept unless Overwrite is set.
+type Processor struct {
+	node.Alias
+
+	Tags      map[string]string `toml:"tags"`
+	Overwrite bool              `toml:"overwrite"`
+
+	loop processors.Loop
+}
+
+func (p *Processor) Name() string {
+	return "add_tags"
+}
+
+func (*Processor) SampleConfig() string {
+	return sampleConfig
+}
+
+// Validate validates that the configuration is acceptable.
+func (p *Processor) Validate() error {
+	if len(p.Tags) == 0 {
+		return errors.New("tags is required")
+	}
+	for k, v := range p.Tags {
+		if k == "" || v == "" {
+			return errors.New("tags must have a non-empty key and value")
+		}
+	}
+	return nil
+}
+
+func (p *Processor) Init() error {
+	return p.Validate()
+}
+
+func (p *Processor) Start(in edge.Edge, out edge.Edge) error {
+	p.loop.Start(p.AliasOr(p.Name()), in, out, p.Process)
+	return nil
+}
+
+func (p *Processor) Stop() error {
+	p.loop.Stop()
+	return nil
+}
+
+// Process adds the tags to pt, it is always kept.
+func (p *Processor) Process(pt *edge.Point) bool {
+	if pt.Tags == nil {
+		pt.Tags = make(map[string]string, len(p.Tags))
+	}
+	for k, v := range p.Tags {
+		if _, ok := pt.Tags[k]; ok && !p.Overwrite {
+			continue
+		}
+		pt.Tags[k] = v
+	}
+	return true
+}
+
+func init() {
+	processors.Add("add_tags", func() node.Node {
+		return &Processor{}
+	})
+}
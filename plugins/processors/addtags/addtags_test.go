@@ -0,0 +1,71 @@
+/*
+Copyright 2022 Huawei Cloud Computing Technologies Co., Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package addtags_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/openGemini/openGemini-forwarder/edge"
+	"github.com/openGemini/openGemini-forwarder/plugins/processors/addtags"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcessor(t *testing.T) {
+	p := &addtags.Processor{Tags: map[string]string{"dc": "a", "host": "default"}}
+	if !assert.NoError(t, p.Init()) {
+		return
+	}
+
+	pt := &edge.Point{Measurement: "cpu"}
+	assert.True(t, p.Process(pt))
+	assert.Equal(t, map[string]string{"dc": "a", "host": "default"}, pt.Tags)
+
+	pt = &edge.Point{Measurement: "cpu", Tags: map[string]string{"host": "h1"}}
+	p.Process(pt)
+	assert.Equal(t, map[string]string{"dc": "a", "host": "h1"}, pt.Tags)
+
+	p.Overwrite = true
+	p.Process(pt)
+	assert.Equal(t, map[string]string{"dc": "a", "host": "default"}, pt.Tags)
+}
+
+func TestProcessorStop(t *testing.T) {
+	p := &addtags.Processor{Tags: map[string]string{"dc": "a"}}
+	if !assert.NoError(t, p.Init()) {
+		return
+	}
+	in, out := edge.NewEdge("in", 1), edge.NewEdge("out", 0)
+	if !assert.NoError(t, p.Start(in, out)) {
+		return
+	}
+
+	// nobody reads out, the record is nacked on Stop
+	nacked := make(chan error, 1)
+	in.In() <- &edge.Record{
+		Points: []edge.Point{{Measurement: "cpu"}},
+		Done:   func(_ *edge.Record, err error) { nacked <- err },
+	}
+	time.Sleep(20 * time.Millisecond)
+	assert.NoError(t, p.Stop())
+	assert.True(t, errors.Is(<-nacked, edge.ErrStopped))
+}
+
+func TestProcessorValidate(t *testing.T) {
+	assert.Error(t, (&addtags.Processor{}).Validate())
+}
@@ -0,0 +1,242 @@
+/*
+Copyright 2022 Huawei Cloud Computing Technologies Co., Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package convert
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/influxdata/telegraf/filter"
+	"github.com/openGemini/openGemini-forwarder/dag/node"
+	"github.com/openGemini/openGemini-forwarder/edge"
+	"github.com/openGemini/openGemini-forwarder/plugins/processors"
+)
+
+//go:embed sample.conf
+var sampleConfig string
+
+// Processor converts the fields whose key matches one of the globs of a
+// type to that type. The types are tried in the order integer, unsigned,
+// float, boolean and string. A field that cannot be converted is removed,
+// and a point left without fields is dropped.
+type Processor struct {
+	node.Alias
+
+	Integer  []string `toml:"integer"`
+	Unsigned []string `toml:"unsigned"`
+	Float    []string `toml:"float"`
+	Boolean  []string `toml:"boolean"`
+	String   []string `toml:"string"`
+
+	conversions []conversion
+	loop        processors.Loop
+}
+
+// conversion converts the fields matching filter with to.
+type conversion struct {
+	filter filter.Filter
+	to     func(interface{}) (interface{}, bool)
+}
+
+func (p *Processor) Name() string {
+	return "convert"
+}
+
+func (*Processor) SampleConfig() string {
+	return sampleConfig
+}
+
+// Validate validates that the configuration is acceptable.
+func (p *Processor) Validate() error {
+	_, err := p.compile()
+	return err
+}
+
+func (p *Processor) compile() ([]conversion, error) {
+	types := []struct {
+		name  string
+		globs []string
+		to    func(interface{}) (interface{}, bool)
+	}{
+		{"integer", p.Integer, toInteger},
+		{"unsigned", p.Unsigned, toUnsigned},
+		{"float", p.Float, toFloat},
+		{"boolean", p.Boolean, toBoolean},
+		{"string", p.String, toString},
+	}
+	var conversions []conversion
+	for _, t := range types {
+		f, err := filter.Compile(t.globs)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", t.name, err)
+		}
+		if f != nil {
+			conversions = append(conversions, conversion{filter: f, to: t.to})
+		}
+	}
+	if len(conversions) == 0 {
+		return nil, errors.New("integer, unsigned, float, boolean or string is required")
+	}
+	return conversions, nil
+}
+
+func (p *Processor) Init() error {
+	var err error
+	p.conversions, err = p.compile()
+	return err
+}
+
+func (p *Processor) Start(in edge.Edge, out edge.Edge) error {
+	p.loop.Start(p.AliasOr(p.Name()), in, out, p.Process)
+	return nil
+}
+
+func (p *Processor) Stop() error {
+	p.loop.Stop()
+	return nil
+}
+
+// Process converts the fields of pt, it reports whether pt still has
+// fields.
+func (p *Processor) Process(pt *edge.Point) bool {
+	for k, v := range pt.Fields {
+		for _, c := range p.conversions {
+			if !c.filter.Match(k) {
+				continue
+			}
+			if converted, ok := c.to(v); ok {
+				pt.Fields[k] = converted
+			} else {
+				delete(pt.Fields, k)
+			}
+			break
+		}
+	}
+	return len(pt.Fields) > 0
+}
+
+func toInteger(v interface{}) (interface{}, bool) {
+	switch v := v.(type) {
+	case int64:
+		return v, true
+	case uint64:
+		return int64(v), v <= math.MaxInt64
+	case float64:
+		return int64(v), v >= math.MinInt64 && v < math.MaxInt64
+	case bool:
+		if v {
+			return int64(1), true
+		}
+		return int64(0), true
+	case string:
+		if i, err := strconv.ParseInt(v, 0, 64); err == nil {
+			return i, true
+		}
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return toInteger(f)
+		}
+	}
+	return nil, false
+}
+
+func toUnsigned(v interface{}) (interface{}, bool) {
+	switch v := v.(type) {
+	case int64:
+		return uint64(v), v >= 0
+	case uint64:
+		return v, true
+	case float64:
+		return uint64(v), v >= 0 && v < math.MaxUint64
+	case bool:
+		if v {
+			return uint64(1), true
+		}
+		return uint64(0), true
+	case string:
+		if u, err := strconv.ParseUint(v, 0, 64); err == nil {
+			return u, true
+		}
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return toUnsigned(f)
+		}
+	}
+	return nil, false
+}
+
+func toFloat(v interface{}) (interface{}, bool) {
+	switch v := v.(type) {
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case bool:
+		if v {
+			return float64(1), true
+		}
+		return float64(0), true
+	case string:
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f, true
+		}
+	}
+	return nil, false
+}
+
+func toBoolean(v interface{}) (interface{}, bool) {
+	switch v := v.(type) {
+	case int64:
+		return v != 0, true
+	case uint64:
+		return v != 0, true
+	case float64:
+		return v != 0, true
+	case bool:
+		return v, true
+	case string:
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b, true
+		}
+	}
+	return nil, false
+}
+
+func toString(v interface{}) (interface{}, bool) {
+	switch v := v.(type) {
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	case uint64:
+		return strconv.FormatUint(v, 10), true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(v), true
+	case string:
+		return v, true
+	}
+	return nil, false
+}
+
+func init() {
+	processors.Add("convert", func() node.Node {
+		return &Processor{}
+	})
+}
@@ -0,0 +1,63 @@
+/*
+Copyright 2022 Huawei Cloud Computing Technologies Co., Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package convert_test
+
+import (
+	"testing"
+
+	"github.com/openGemini/openGemini-forwarder/edge"
+	"github.com/openGemini/openGemini-forwarder/plugins/processors/convert"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcessor(t *testing.T) {
+	p := &convert.Processor{
+		Integer:  []string{"*_count"},
+		Unsigned: []string{"bytes"},
+		Float:    []string{"usage"},
+		Boolean:  []string{"up"},
+		String:   []string{"version"},
+	}
+	if !assert.NoError(t, p.Init()) {
+		return
+	}
+
+	pt := &edge.Point{Fields: map[string]interface{}{
+		"req_count": "12",
+		"err_count": 3.7,
+		"bytes":     int64(-1),
+		"usage":     int64(5),
+		"up":        "true",
+		"version":   2.0,
+		"other":     "x",
+	}}
+	assert.True(t, p.Process(pt))
+	assert.Equal(t, map[string]interface{}{
+		"req_count": int64(12),
+		"err_count": int64(3),
+		"usage":     float64(5),
+		"up":        true,
+		"version":   "2",
+		"other":     "x",
+	}, pt.Fields)
+
+	assert.False(t, p.Process(&edge.Point{Fields: map[string]interface{}{"req_count": "a"}}))
+}
+
+func TestProcessorValidate(t *testing.T) {
+	assert.Error(t, (&convert.Processor{}).Validate())
+}
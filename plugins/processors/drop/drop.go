@@ -0,0 +1,114 @@
+/*
+Copyright 2022 Huawei Cloud Computing Technologies Co., Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package drop
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+
+	"github.com/influxdata/telegraf/filter"
+	"github.com/openGemini/openGemini-forwarder/dag/node"
+	"github.com/openGemini/openGemini-forwarder/edge"
+	"github.com/openGemini/openGemini-forwarder/plugins/processors"
+)
+
+//go:embed sample.conf
+var sampleConfig string
+
+// Processor drops the points whose measurement matches one of the globs of
+// Measurements, or that have a tag whose value matches one of the globs of
+// the tag in Tags.
+type Processor struct {
+	node.Alias
+
+	Measurements []string            `toml:"measurements"`
+	Tags         map[string][]string `toml:"tags"`
+
+	measurements filter.Filter
+	tags         map[string]filter.Filter
+	loop         processors.Loop
+}
+
+func (p *Processor) Name() string {
+	return "drop"
+}
+
+func (*Processor) SampleConfig() string {
+	return sampleConfig
+}
+
+// Validate validates that the configuration is acceptable.
+func (p *Processor) Validate() error {
+	if len(p.Measurements) == 0 && len(p.Tags) == 0 {
+		return errors.New("measurements or tags is required")
+	}
+	_, _, err := p.compile()
+	return err
+}
+
+func (p *Processor) compile() (filter.Filter, map[string]filter.Filter, error) {
+	measurements, err := filter.Compile(p.Measurements)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid measurements: %v", err)
+	}
+	tags := make(map[string]filter.Filter, len(p.Tags))
+	for k, globs := range p.Tags {
+		if tags[k], err = filter.Compile(globs); err != nil {
+			return nil, nil, fmt.Errorf("invalid tags %q: %v", k, err)
+		}
+	}
+	return measurements, tags, nil
+}
+
+func (p *Processor) Init() error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	var err error
+	p.measurements, p.tags, err = p.compile()
+	return err
+}
+
+func (p *Processor) Start(in edge.Edge, out edge.Edge) error {
+	p.loop.Start(p.AliasOr(p.Name()), in, out, p.Process)
+	return nil
+}
+
+func (p *Processor) Stop() error {
+	p.loop.Stop()
+	return nil
+}
+
+// Process reports whether pt is kept.
+func (p *Processor) Process(pt *edge.Point) bool {
+	if p.measurements != nil && p.measurements.Match(pt.Measurement) {
+		return false
+	}
+	for k, f := range p.tags {
+		if v, ok := pt.Tags[k]; ok && f != nil && f.Match(v) {
+			return false
+		}
+	}
+	return true
+}
+
+func init() {
+	processors.Add("drop", func() node.Node {
+		return &Processor{}
+	})
+}
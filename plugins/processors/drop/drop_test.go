@@ -0,0 +1,45 @@
+/*
+Copyright 2022 Huawei Cloud Computing Technologies Co., Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package drop_test
+
+import (
+	"testing"
+
+	"github.com/openGemini/openGemini-forwarder/edge"
+	"github.com/openGemini/openGemini-forwarder/plugins/processors/drop"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcessor(t *testing.T) {
+	p := &drop.Processor{
+		Measurements: []string{"debug_*"},
+		Tags:         map[string][]string{"env": {"test", "dev-?"}},
+	}
+	if !assert.NoError(t, p.Init()) {
+		return
+	}
+
+	assert.False(t, p.Process(&edge.Point{Measurement: "debug_cpu"}))
+	assert.False(t, p.Process(&edge.Point{Measurement: "cpu", Tags: map[string]string{"env": "dev-1"}}))
+	assert.True(t, p.Process(&edge.Point{Measurement: "cpu", Tags: map[string]string{"env": "prod"}}))
+	assert.True(t, p.Process(&edge.Point{Measurement: "cpu"}))
+}
+
+func TestProcessorValidate(t *testing.T) {
+	assert.Error(t, (&drop.Processor{}).Validate())
+	assert.Error(t, (&drop.Processor{Measurements: []string{"[a"}}).Validate())
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2022 Huawei Cloud Computing Technologies Co., Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package processors
+
+import (
+	"context"
+	"sync"
+
+	"github.com/openGemini/openGemini-forwarder/edge"
+	"github.com/openGemini/openGemini-forwarder/lib/metrics"
+)
+
+// Loop runs the process function of a processor on every point of the
+// records of its input edge, the points it returns false for are dropped.
+// A record whose points are all dropped is acked, the others are written to
+// the output edge. Records without points, such as the ones of the
+// transparent parser, are written as they are.
+type Loop struct {
+	wg     sync.WaitGroup
+	cancel context.CancelFunc
+}
+
+func (l *Loop) Start(stage string, in edge.Edge, out edge.Edge, process func(*edge.Point) bool) {
+	ctx, cancel := context.WithCancel(context.Background())
+	l.cancel = cancel
+	received := metrics.NodeRecords.WithLabelValues(stage, metrics.In)
+	emitted := metrics.NodeRecords.WithLabelValues(stage, metrics.Out)
+	dropped := metrics.NodeRecords.WithLabelValues(stage, metrics.Dropped)
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case record := <-in.Out():
+				received.Inc()
+				if len(record.Points) > 0 && !processPoints(record, process) {
+					dropped.Inc()
+					record.Ack()
+					continue
+				}
+				select {
+				case out.In() <- record:
+					emitted.Inc()
+				case <-ctx.Done():
+					record.Nack(edge.WithStage(stage, edge.ErrStopped))
+					return
+				}
+			}
+		}
+	}()
+}
+
+// processPoints keeps the points of record that process returns true for,
+// it returns false if none is left.
+func processPoints(record *edge.Record, process func(*edge.Point) bool) bool {
+	points := record.Points[:0]
+	for i := range record.Points {
+		if process(&record.Points[i]) {
+			points = append(points, record.Points[i])
+		}
+	}
+	record.Points = points
+	return len(points) > 0
+}
+
+// Stop stops the loop, the record being processed is nacked if it cannot
+// be written meanwhile.
+func (l *Loop) Stop() {
+	l.cancel()
+	l.wg.Wait()
+}
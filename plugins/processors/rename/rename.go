@@ -0,0 +1,110 @@
+/*
+Copyright 2022 Huawei Cloud Computing Technologies Co., Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rename
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+
+	"github.com/openGemini/openGemini-forwarder/dag/node"
+	"github.com/openGemini/openGemini-forwarder/edge"
+	"github.com/openGemini/openGemini-forwarder/plugins/processors"
+)
+
+//go:embed sample.conf
+var sampleConfig string
+
+// Processor renames measurements, tag keys and field keys, each map goes
+// from the old name to the new one. A renamed tag or field replaces the one
+// that already has the new name.
+type Processor struct {
+	node.Alias
+
+	Measurements map[string]string `toml:"measurements"`
+	Tags         map[string]string `toml:"tags"`
+	Fields       map[string]string `toml:"fields"`
+
+	loop processors.Loop
+}
+
+func (p *Processor) Name() string {
+	return "rename"
+}
+
+func (*Processor) SampleConfig() string {
+	return sampleConfig
+}
+
+// Validate validates that the configuration is acceptable.
+func (p *Processor) Validate() error {
+	if len(p.Measurements) == 0 && len(p.Tags) == 0 && len(p.Fields) == 0 {
+		return errors.New("measurements, tags or fields is required")
+	}
+	for kind, names := range map[string]map[string]string{
+		"measurements": p.Measurements,
+		"tags":         p.Tags,
+		"fields":       p.Fields,
+	} {
+		for from, to := range names {
+			if to == "" {
+				return fmt.Errorf("%s: empty new name for %q", kind, from)
+			}
+		}
+	}
+	return nil
+}
+
+func (p *Processor) Init() error {
+	return p.Validate()
+}
+
+func (p *Processor) Start(in edge.Edge, out edge.Edge) error {
+	p.loop.Start(p.AliasOr(p.Name()), in, out, p.Process)
+	return nil
+}
+
+func (p *Processor) Stop() error {
+	p.loop.Stop()
+	return nil
+}
+
+// Process renames the measurement, tags and fields of pt, it is always kept.
+func (p *Processor) Process(pt *edge.Point) bool {
+	if to, ok := p.Measurements[pt.Measurement]; ok {
+		pt.Measurement = to
+	}
+	for from, to := range p.Tags {
+		if v, ok := pt.Tags[from]; ok {
+			delete(pt.Tags, from)
+			pt.Tags[to] = v
+		}
+	}
+	for from, to := range p.Fields {
+		if v, ok := pt.Fields[from]; ok {
+			delete(pt.Fields, from)
+			pt.Fields[to] = v
+		}
+	}
+	return true
+}
+
+func init() {
+	processors.Add("rename", func() node.Node {
+		return &Processor{}
+	})
+}
@@ -0,0 +1,53 @@
+/*
+Copyright 2022 Huawei Cloud Computing Technologies Co., Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rename_test
+
+import (
+	"testing"
+
+	"github.com/openGemini/openGemini-forwarder/edge"
+	"github.com/openGemini/openGemini-forwarder/plugins/processors/rename"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcessor(t *testing.T) {
+	p := &rename.Processor{
+		Measurements: map[string]string{"cpu_usage": "cpu"},
+		Tags:         map[string]string{"hostname": "host"},
+		Fields:       map[string]string{"usage_pct": "usage"},
+	}
+	if !assert.NoError(t, p.Init()) {
+		return
+	}
+
+	pt := &edge.Point{
+		Measurement: "cpu_usage",
+		Tags:        map[string]string{"hostname": "h1", "dc": "a"},
+		Fields:      map[string]interface{}{"usage_pct": 1.5, "idle": 2.0},
+	}
+	assert.True(t, p.Process(pt))
+	assert.Equal(t, &edge.Point{
+		Measurement: "cpu",
+		Tags:        map[string]string{"host": "h1", "dc": "a"},
+		Fields:      map[string]interface{}{"usage": 1.5, "idle": 2.0},
+	}, pt)
+}
+
+func TestProcessorValidate(t *testing.T) {
+	assert.Error(t, (&rename.Processor{}).Validate())
+	assert.Error(t, (&rename.Processor{Tags: map[string]string{"a": ""}}).Validate())
+}